@@ -0,0 +1,182 @@
+package madison
+
+import (
+	"fmt"
+	"math"
+)
+
+// Represents the integers equal to Rem, modulo Mod. A Mod below 2 places no
+// constraint.
+type Congruence struct {
+	Mod, Rem int
+}
+
+// Pretty-prints this congruence.
+func (c Congruence) String() string {
+	return fmt.Sprintf("≡ %d (mod %d)", c.Rem, c.Mod)
+}
+
+// Returns the congruence of values equal to r modulo m, with r in [0, m).
+// An m of zero means exactly r.
+func makeCongruence(m, r int) Congruence {
+	if m < 0 {
+		m = -m
+	}
+	if m == 0 && r > math.MinInt32 && r < math.MaxInt32 {
+		return Congruence{0, r}
+	} else if m == 0 || m == 1 || m >= math.MaxInt32 {
+		return Congruence{1, 0}
+	}
+	return Congruence{m, (r%m + m) % m}
+}
+
+// Returns the congruence holding every value of the scalar t: exact for
+// constants, and none at all if t has no Stride.
+func (t Type) congruence() Congruence {
+	if t.Set == nil && t.Start == t.End && t.Start > math.MinInt32 &&
+		t.Start < math.MaxInt32 {
+		return Congruence{0, t.Start}
+	} else if t.Stride.Mod < 2 {
+		return Congruence{1, 0}
+	}
+	return t.Stride
+}
+
+// Returns a copy of t holding only the values in c, with its bounds
+// tightened to match, and false if there are none.
+func (t Type) withStride(c Congruence) (Type, bool) {
+	if c.Mod == 0 {
+		if !t.ranges().contains(c.Rem) {
+			return t, false
+		}
+		return t.withRanges(RangeSet{{c.Rem, c.Rem}}), true
+	}
+	t.Stride = Congruence{}
+	if c.Mod < 2 || t.Elem != nil {
+		return t, true
+	}
+
+	var pieces []Range
+	for _, r := range t.ranges() {
+		if r.Start > math.MinInt32 {
+			r.Start += ((c.Rem-r.Start)%c.Mod + c.Mod) % c.Mod
+		}
+		if r.End < math.MaxInt32 {
+			r.End -= ((r.End-c.Rem)%c.Mod + c.Mod) % c.Mod
+		}
+		if r.Start <= r.End {
+			pieces = append(pieces, r)
+		}
+	}
+	if len(pieces) == 0 {
+		return t, false
+	}
+	t = t.withRanges(Ranges(pieces...))
+	if t.Set != nil || t.Start != t.End {
+		t.Stride = c
+	}
+	return t, true
+}
+
+// Returns t holding only the values in c, if there are any.
+func strided(t Type, c Congruence) Type {
+	if s, ok := t.withStride(c); ok {
+		return s
+	}
+	return t
+}
+
+// Returns the type of a - b, for scalars a and b.
+func difference(a, b Type) Type {
+	return strided(typeOf(a.ranges().add(b.ranges().negate())),
+		congruenceSum(a.congruence(), congruenceNegation(b.congruence())))
+}
+
+// Returns the type of a % b, for scalars a and b (where b is not zero).
+func remainder(a, b Type) Type {
+	var rems []Range
+	for _, r := range b.ranges() {
+		rems = append(rems, rem(a.Range, r))
+	}
+	t := typeOf(Ranges(rems...))
+	c := a.congruence()
+	if b.Set != nil || !b.IsConst() || c.Mod == 0 || c.Mod%b.Start != 0 {
+		return t
+	}
+
+	// A is R modulo B, so A % B is R % B (or, if A is negative, -(-R % B)).
+	m := abs(b.Start)
+	var rs []Range
+	if a.End >= 0 {
+		pos := (c.Rem%m + m) % m
+		rs = append(rs, Range{pos, pos})
+	}
+	if a.Start < 0 {
+		neg := -((-c.Rem%m + m) % m)
+		rs = append(rs, Range{neg, neg})
+	}
+	if s := t.ranges().intersect(Ranges(rs...)); len(s) > 0 {
+		return t.withRanges(s)
+	}
+	return t
+}
+
+// Returns the congruence of a + b.
+func congruenceSum(a, b Congruence) Congruence {
+	return makeCongruence(gcd(a.Mod, b.Mod), a.Rem+b.Rem)
+}
+
+// Returns the congruence of -a.
+func congruenceNegation(a Congruence) Congruence {
+	return makeCongruence(a.Mod, -a.Rem)
+}
+
+// Returns the congruence of a * b.
+func congruenceProduct(a, b Congruence) Congruence {
+	m := gcd(gcd(a.Mod*b.Mod, a.Mod*b.Rem), b.Mod*a.Rem)
+	return makeCongruence(m, a.Rem*b.Rem)
+}
+
+// Returns the congruence holding the values of either a or b.
+func congruenceUnion(a, b Congruence) Congruence {
+	return makeCongruence(gcd(gcd(a.Mod, b.Mod), a.Rem-b.Rem), a.Rem)
+}
+
+// Returns a congruence holding the values of both a and b (not necessarily
+// all of them), and false if there can be none.
+func congruenceMeet(a, b Congruence) (Congruence, bool) {
+	switch {
+	case a.Mod == 1:
+		return b, true
+	case b.Mod == 1:
+		return a, true
+	case a.Mod == 0:
+		return a, b.Mod == 0 && a.Rem == b.Rem || b.Mod > 0 && (a.Rem-b.Rem)%b.Mod == 0
+	case b.Mod == 0:
+		return b, (b.Rem-a.Rem)%a.Mod == 0
+	case b.Mod%a.Mod == 0:
+		return b, (b.Rem-a.Rem)%a.Mod == 0
+	case a.Mod%b.Mod == 0:
+		return a, (a.Rem-b.Rem)%b.Mod == 0
+	}
+	return a, true
+}
+
+// Returns true if every value in a is also in b.
+func (a Congruence) within(b Congruence) bool {
+	if b.Mod == 1 {
+		return true
+	} else if b.Mod == 0 {
+		return a.Mod == 0 && a.Rem == b.Rem
+	}
+	return a.Mod%b.Mod == 0 && (a.Rem-b.Rem)%b.Mod == 0
+}
+
+// Returns the greatest common divisor of a and b (which is zero if both are).
+func gcd(a, b int) int {
+	a, b = abs(a), abs(b)
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,208 @@
+package madison
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// How many calls are evaluated while looking for a counterexample.
+const counterexampleTries = 2000
+
+// How deeply calls may nest while evaluating a possible counterexample before
+// it is given up on.
+const counterexampleDepth = 10000
+
+// How far past zero to look for values in unbounded ranges.
+const sampleLimit = 1000
+
+// The most integers in a range that are all tried.
+const sampleAll = 32
+
+// The longest list to try as an argument.
+const sampleLength = 8
+
+// Raised by Apply.Eval when calls nest too deeply.
+var errTooDeep = errors.New("calls nested too deeply")
+
+// Represents a failure found by analysis that really happens when the
+// function is called with Args.
+type Counterexample struct {
+	// The function that was called.
+	Name string
+
+	// The (concrete) arguments that it was called with.
+	Args []Obj
+
+	// What evaluating the call panicked with.
+	Failure interface{}
+
+	// The failure found by analysis.
+	Err error
+}
+
+// Represent the failure, along with the call that triggers it, as an error.
+func (c *Counterexample) Error() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s (e.g. %s(%s) fails: %v)",
+		c.Err, c.Name, strings.Join(args, ", "), c.Failure)
+}
+
+// Returns the failure found by analysis.
+func (c *Counterexample) Unwrap() error {
+	return c.Err
+}
+
+// Computes the type of calling name with arguments of the given types. If
+// that may fail, it looks for arguments that really do make it fail, and
+// returns a *Counterexample if it finds them. Otherwise the failure may be
+// spurious, and the error is returned as is.
+func (r *Runtime) Analyse(name string, args []Type) (Type, error) {
+	vars := make([]Node, len(args))
+	for i := range vars {
+		vars[i] = &Var{i}
+	}
+	typ, err := (&Apply{r, name, vars}).Type(nil, args)
+	if err == nil || err == errDiverges {
+		return typ, err
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	pools := make([][]Obj, len(args))
+	total := 1
+	for i, arg := range args {
+		if pools[i] = samples(arg, rnd); len(pools[i]) == 0 {
+			return NIL, err
+		}
+		if total *= len(pools[i]); total > counterexampleTries {
+			total = counterexampleTries
+		}
+	}
+
+	run := r.limited(counterexampleDepth)
+	for i := 0; i < total; i++ {
+		objs := make([]Obj, len(args))
+		k := i
+		for j, pool := range pools {
+			if total < counterexampleTries {
+				objs[j], k = pool[k%len(pool)], k/len(pool)
+			} else {
+				objs[j] = pool[rnd.Intn(len(pool))]
+			}
+		}
+		if failure := run.fails(name, objs); failure != nil {
+			return NIL, &Counterexample{name, objs, failure, err}
+		}
+	}
+	return NIL, err
+}
+
+// Evaluates a call of name with args, returning how the program failed (if
+// it did). Any other panic is passed on.
+func (r *Runtime) fails(name string, args []Obj) (failure interface{}) {
+	defer func() {
+		p := recover()
+		if f, ok := p.(Failure); ok {
+			failure = f
+		} else if p != nil && p != errTooDeep {
+			panic(p)
+		}
+	}()
+	r.Funcs[name].Eval(args)
+	return nil
+}
+
+// Returns a copy of r whose calls raise errTooDeep once nested more than
+// maxDepth deep. Evaluating it leaves r untouched.
+func (r *Runtime) limited(maxDepth int) *Runtime {
+	l := &Runtime{Funcs: make(map[string]Node, len(r.Funcs)), maxDepth: maxDepth}
+	for name, f := range r.Funcs {
+		l.Funcs[name] = rebind(f, l)
+	}
+	return l
+}
+
+// Returns some values of type t worth trying: its bounds, those around zero,
+// and a few at random.
+func samples(t Type, rnd *rand.Rand) []Obj {
+	var objs []Obj
+	if t.Elem == nil {
+		for _, v := range sampleInts(t.Range, rnd) {
+			objs = append(objs, Obj{Int: int64(v)})
+		}
+		return objs
+	}
+
+	elems := samples(*t.Elem, rnd)
+	leading := make([][]Obj, len(t.Prefix))
+	for i, p := range t.Prefix {
+		leading[i] = samples(p, rnd)
+	}
+	lengths := t.Range
+	if lengths.Start < 0 {
+		lengths.Start = 0
+	}
+	if lengths.End > sampleLength && lengths.Start <= sampleLength {
+		lengths.End = sampleLength
+	} else if lengths.End > sampleLength {
+		lengths.End = lengths.Start
+	}
+	for _, n := range sampleInts(lengths, rnd) {
+		if n > 0 && len(elems) == 0 {
+			continue
+		}
+		for _, fill := range []int{0, len(elems) - 1, -1, -1} {
+			vals := make([]Obj, n)
+			for i := range vals {
+				if fill >= 0 {
+					vals[i] = elems[fill]
+				} else {
+					vals[i] = elems[rnd.Intn(len(elems))]
+				}
+			}
+			for i, first := range leading {
+				if i < n && len(first) > 0 {
+					vals[i] = first[rnd.Intn(len(first))]
+				}
+			}
+			objs = append(objs, Obj{Vals: vals})
+		}
+	}
+	return objs
+}
+
+// Returns some integers in r worth trying: all of them, if there are few.
+func sampleInts(r Range, rnd *rand.Rand) []int {
+	lo, hi := r.Start, r.End
+	if lo == math.MinInt32 {
+		lo = -sampleLimit
+	}
+	if hi == math.MaxInt32 {
+		hi = sampleLimit
+	}
+	if lo > hi {
+		lo, hi = r.Start, r.End
+	}
+
+	var ints []int
+	if hi-lo < sampleAll {
+		for v := lo; v <= hi; v++ {
+			ints = append(ints, v)
+		}
+		return ints
+	}
+	seen := map[int]bool{}
+	for _, v := range []int{lo, hi, 0, 1, -1, lo + 1, hi - 1, lo/2 + hi/2,
+		lo + rnd.Intn(hi-lo+1), lo + rnd.Intn(hi-lo+1)} {
+		if v >= r.Start && v <= r.End && !seen[v] {
+			ints = append(ints, v)
+			seen[v] = true
+		}
+	}
+	return ints
+}
@@ -0,0 +1,29 @@
+package madison
+
+import (
+	"testing"
+)
+
+func TestFails(t *testing.T) {
+	r := &Runtime{Funcs: map[string]Node{
+		"empty":   &Head{EmptyList{}},
+		"forever": &Apply{nil, "forever", nil},
+		"broken":  &Var{1},
+	}}
+	run := r.limited(10)
+
+	if got := run.fails("empty", nil); got != Failure("head of an empty list") {
+		t.Errorf("empty fails with %v", got)
+	}
+	if got := run.fails("forever", nil); got != nil {
+		t.Errorf("forever fails with %v (expecting it to be given up on)", got)
+	}
+
+	// A panic in the interpreter itself is not a counterexample.
+	defer func() {
+		if recover() == nil {
+			t.Errorf("broken did not panic")
+		}
+	}()
+	run.fails("broken", []Obj{{Int: 1}})
+}
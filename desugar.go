@@ -0,0 +1,206 @@
+package madison
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Text from a file, remembering where each byte came from.
+type source struct {
+	text string
+	pos  []Pos
+}
+
+// Returns the given line of text, starting at column 1.
+func newSource(text string, line int) source {
+	src := source{text, make([]Pos, len(text))}
+	for i := range text {
+		src.pos[i] = Pos{line, i + 1}
+	}
+	return src
+}
+
+// Returns text that was inserted at the given position.
+func inserted(text string, at Pos) source {
+	src := source{text, make([]Pos, len(text))}
+	for i := range src.pos {
+		src.pos[i] = at
+	}
+	return src
+}
+
+// Returns the bytes of s between i and j.
+func (s source) slice(i, j int) source {
+	return source{s.text[i:j], s.pos[i:j]}
+}
+
+// Removes the leading and trailing whitespace from s.
+func (s source) trim() source {
+	i, j := 0, len(s.text)
+	for i < j && unicode.IsSpace(rune(s.text[i])) {
+		i++
+	}
+	for j > i && unicode.IsSpace(rune(s.text[j-1])) {
+		j--
+	}
+	return s.slice(i, j)
+}
+
+// Returns where the byte at i came from (or the end of s).
+func (s source) at(i int) Pos {
+	if i < len(s.pos) {
+		return s.pos[i]
+	} else if len(s.pos) > 0 {
+		end := s.pos[len(s.pos)-1]
+		return Pos{end.Line, end.Col + 1}
+	}
+	return Pos{}
+}
+
+// Joins the given pieces of text together.
+func join(pieces ...source) source {
+	var out source
+	for _, p := range pieces {
+		out.text += p.text
+		out.pos = append(out.pos, p.pos...)
+	}
+	return out
+}
+
+// Rewrites the keyword forms that mast can't parse into function calls:
+//
+//	if c then a else b        =>  if(c, a, b)
+//	let x = v in body         =>  let(x, v, body)
+//	f = body where x = v; ... =>  f = let(x, v, ...body)
+func desugar(src source) source {
+	if eq := scanTo(src.text, 0, "="); eq < len(src.text) {
+		i := scanTo(src.text, eq+1, "where")
+		if i < len(src.text) {
+			body := src.slice(eq+1, i).trim()
+			rest := src.slice(i+len("where"), len(src.text))
+			var bindings []source
+			for start := 0; start < len(rest.text); {
+				end := scanTo(rest.text, start, "")
+				bindings = append(bindings, rest.slice(start, end).trim())
+				start = end + 1
+			}
+			for j := len(bindings) - 1; j >= 0; j-- {
+				b := bindings[j]
+				body = join(inserted("let ", b.at(0)), b,
+					inserted(" in ", b.at(len(b.text))), body)
+			}
+			src = join(src.slice(0, eq+1), inserted(" ", src.at(eq)), body)
+		}
+	}
+	return desugarExpr(src)
+}
+
+// Rewrites the if and let forms in an expression.
+func desugarExpr(src source) source {
+	var out source
+	for i := 0; i < len(src.text); {
+		word := wordAt(src.text, i)
+		var parts []source
+		end := i
+		switch word {
+		case "if":
+			parts, end = scanAll(src, i+len(word), "then", "else", "")
+		case "let":
+			parts, end = scanAll(src, i+len(word), "=", "in", "")
+		}
+		if parts == nil {
+			out = join(out, src.slice(i, i+1))
+			i++
+			continue
+		}
+		out = join(out, src.slice(i, i+len(word)), inserted("(", src.at(i)))
+		for j, part := range parts {
+			if j > 0 {
+				out = join(out, inserted(", ", part.at(0)))
+			}
+			out = join(out, desugarExpr(part).trim())
+		}
+		out = join(out, inserted(")", src.at(end)))
+		i = end
+	}
+	return out
+}
+
+// Splits the text from start at each of the given keywords (see scanTo),
+// returning the pieces in between and where the last one ends, or nil if
+// a keyword is missing.
+func scanAll(src source, start int, stops ...string) ([]source, int) {
+	parts := []source{}
+	for _, stop := range stops {
+		end := scanTo(src.text, start, stop)
+		if stop != "" && end >= len(src.text) {
+			return nil, start
+		}
+		parts = append(parts, src.slice(start, end).trim())
+		start = end + len(stop)
+	}
+	return parts, start
+}
+
+// Returns where the keyword stop (or, if stop is empty, the end of the
+// enclosing expression) appears in text after start.
+func scanTo(text string, start int, stop string) int {
+	depth, open := 0, 0 // open counts the ifs and lets we are inside
+	i := start
+	for ; i < len(text); i++ {
+		word := wordAt(text, i)
+		switch {
+		case strings.ContainsRune("([", rune(text[i])):
+			depth++
+		case strings.ContainsRune(")]", rune(text[i])):
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case depth > 0:
+		case word == "if" || word == "let":
+			open++
+		case open > 0 && (word == "else" || word == "in"):
+			open--
+		case open > 0:
+		case stop == "" && (text[i] == ',' || text[i] == ';'):
+			return i
+		case stop == "=" && isEquals(text, i):
+			return i
+		case word == "":
+		case word == stop || stop == "" && isKeyword(word):
+			return i
+		}
+		if word != "" {
+			i += len(word) - 1
+		}
+	}
+	return i
+}
+
+// Returns true if the given identifier ends part of an if or let.
+func isKeyword(word string) bool {
+	return word == "then" || word == "else" || word == "in" || word == "where"
+}
+
+// Returns true if text has a lone = (rather than ==, <=, ...) at i.
+func isEquals(text string, i int) bool {
+	return text[i] == '=' && (i == 0 || !strings.ContainsRune("=<>!", rune(text[i-1]))) &&
+		(i+1 == len(text) || text[i+1] != '=')
+}
+
+// Returns the identifier starting at i, if there is one.
+func wordAt(text string, i int) string {
+	isWord := func(c byte) bool {
+		return c == '_' || c == '\'' || unicode.IsLetter(rune(c)) ||
+			unicode.IsDigit(rune(c))
+	}
+	if i > 0 && isWord(text[i-1]) {
+		return ""
+	}
+	j := i
+	for j < len(text) && isWord(text[j]) {
+		j++
+	}
+	return text[i:j]
+}
@@ -0,0 +1,30 @@
+package madison
+
+import (
+	"testing"
+)
+
+var desugared = []struct {
+	Text, Exp string
+}{
+	{"f x = x + 1", "f x = x + 1"},
+	{"f x = ifz(x, 1, 2)", "f x = ifz(x, 1, 2)"},
+	{"f x = if x < 3 then 1 else 2", "f x = if(x < 3, 1, 2)"},
+	{"f x = if x then if y then 1 else 2 else 3",
+		"f x = if(x, if(y, 1, 2), 3)"},
+	{"f x = g(if x then 1 else 0, 4) + 1", "f x = g(if(x, 1, 0), 4) + 1"},
+	{"f x = let y = x * 2 in y + y", "f x = let(y, x * 2, y + y)"},
+	{"f x = let y = let z = 1 in z in y", "f x = let(y, let(z, 1, z), y)"},
+	{"f x = if x == 1 then 2 else 3", "f x = if(x == 1, 2, 3)"},
+	{"f x = y + z where y = x; z = y * 2",
+		"f x = let(y, x, let(z, y * 2, y + z))"},
+	{"f x = shift x", "f x = shift x"},
+}
+
+func TestDesugar(t *testing.T) {
+	for i, c := range desugared {
+		if got := desugar(newSource(c.Text, 1)).text; got != c.Exp {
+			t.Errorf("%d: desugar(%q) = %q (expecting %q)", i, c.Text, got, c.Exp)
+		}
+	}
+}
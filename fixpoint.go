@@ -0,0 +1,140 @@
+package madison
+
+import (
+	"errors"
+)
+
+// How many nested calls to the same function are analysed separately before
+// their arguments are merged.
+const unrollLimit = 64
+
+// How many iterations join results together before widening them.
+const widenDelay = 3
+
+// How many narrowing passes are made once a fixpoint has been reached.
+const narrowSteps = 2
+
+// Raised when a function has no result (yet); treated as an unreachable
+// branch by If.
+var errDiverges = errors.New("function never returns")
+
+// Tracks the state of a function call that may be the head of a recursive
+// loop.
+type frame struct {
+	// The (possibly widened) arguments being analysed.
+	args []Type
+
+	// The current guess for the result; nil if there is none yet.
+	result *Type
+
+	// Whether a recursive call relied on result.
+	used bool
+
+	// Whether a recursive call grew args.
+	grown bool
+
+	// Whether args have ever been widened.
+	widened bool
+
+	// Whether the result relied on the guess of an enclosing call.
+	provisional bool
+}
+
+// Finds the enclosing call that a call to name with args should reuse,
+// returning its index in callers, or -1 if it should be analysed on its own.
+func loopHead(callers []CallSite, name string, args []Type, limit int) int {
+	last := -1
+	count := 0
+	for i := len(callers) - 1; i >= 0; i-- {
+		f := callers[i].frame
+		if callers[i].Name != name || f == nil {
+			continue
+		}
+		if last < 0 {
+			last = i
+		}
+		count++
+		if subsetOf(args, f.args) && (f.widened || subsetOf(f.args, args)) {
+			return i
+		}
+	}
+	if count >= limit {
+		return last
+	}
+	return -1
+}
+
+// Returns the current guess for a recursive call to f with the given args,
+// widening the arguments of f if needed.
+func (f *frame) reenter(args []Type) (Type, error) {
+	f.used = true
+	if !subsetOf(args, f.args) {
+		widened := make([]Type, len(f.args))
+		for i := range f.args {
+			widened[i] = TypesWiden(f.args[i], args[i])
+		}
+		f.args = widened
+		f.widened, f.grown = true, true
+	}
+	if f.result == nil {
+		return NIL, errDiverges
+	}
+	return *f.result, nil
+}
+
+// Computes the type of funct applied to f.args, iterating until the guesses
+// made for recursive calls are consistent with the result.
+func (f *frame) solve(funct Node, callers []CallSite) (Type, error) {
+	var verified *Type
+	for i, narrowed := 0, 0; ; i++ {
+		f.used, f.grown = false, false
+		typ, err := funct.Type(callers, f.args)
+
+		if f.grown {
+			verified, narrowed = nil, 0
+			continue
+		} else if !f.used || (err != nil && err != errDiverges) {
+			return typ, err
+		}
+
+		// Check whether the guess was big enough.
+		if f.result != nil && (err == errDiverges || typ.SubsetOf(*f.result)) {
+			verified = f.result
+			if err == errDiverges || narrowed == narrowSteps {
+				return *verified, nil
+			}
+			narrowed++
+			f.result = &typ
+			continue
+		} else if verified != nil {
+			return *verified, nil
+		} else if err == errDiverges {
+			return NIL, errDiverges
+		}
+
+		// Grow the guess to include the new result.
+		next := typ
+		if f.result != nil {
+			if next, err = TypesUnion(*f.result, typ); err != nil {
+				return NIL, err
+			}
+			if i >= widenDelay {
+				next = TypesWiden(*f.result, next)
+			}
+		}
+		f.result = &next
+	}
+}
+
+// Returns true if each of the types in a is a subset of the one in b.
+func subsetOf(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].SubsetOf(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,317 @@
+package madison
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// How deeply generated expressions nest.
+const fuzzDepth = 4
+
+// How deeply generated programs may recurse when evaluated.
+const fuzzCalls = 12
+
+// How many argument values each generated program is run with.
+const fuzzSamples = 32
+
+// Builds random programs, and types to call them with, out of the bytes
+// given by the fuzzer.
+type generator struct {
+	data []byte
+	r    *Runtime
+
+	// Whether each local in scope is a list.
+	lists []bool
+}
+
+// Returns a number in [0, n), or zero once the data runs out.
+func (g *generator) next(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := int(g.data[0])
+	g.data = g.data[1:]
+	return b % n
+}
+
+// Returns a local of the given kind, if there is one.
+func (g *generator) local(list bool) (Node, bool) {
+	var found []int
+	for i, l := range g.lists {
+		if l == list {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		return nil, false
+	}
+	return &Var{found[g.next(len(found))]}, true
+}
+
+// Returns a Let binding a new local of either kind over a body of the given
+// kind.
+func (g *generator) let(depth int, list bool) Node {
+	bound := g.next(2) == 0
+	var value Node
+	if bound {
+		value = g.list(depth - 1)
+	} else {
+		value = g.scalar(depth - 1)
+	}
+	g.lists = append(g.lists, bound)
+	defer func() { g.lists = g.lists[:len(g.lists)-1] }()
+	if list {
+		return &Let{len(g.lists) - 1, value, g.list(depth - 1)}
+	}
+	return &Let{len(g.lists) - 1, value, g.scalar(depth - 1)}
+}
+
+// Generates an expression computing an integer.
+func (g *generator) scalar(depth int) Node {
+	if depth <= 0 {
+		if v, ok := g.local(false); ok && g.next(2) == 0 {
+			return v
+		}
+		return Const(g.next(19) - 9)
+	}
+	d := depth - 1
+	switch g.next(16) {
+	case 0:
+		return &Plus{g.scalar(d), g.scalar(d)}
+	case 1:
+		return &Times{g.scalar(d), g.scalar(d)}
+	case 2:
+		return &Divide{g.scalar(d), g.scalar(d)}
+	case 3:
+		return &Modulo{g.scalar(d), g.scalar(d)}
+	case 4:
+		ops := []string{"<", "<=", "==", "!=", ">=", ">"}
+		return &Compare{ops[g.next(len(ops))], g.scalar(d), g.scalar(d)}
+	case 5:
+		return &Negate{g.scalar(d)}
+	case 6, 7:
+		return &If{g.scalar(d), g.scalar(d), g.scalar(d)}
+	case 8:
+		return g.let(depth, false)
+	case 9:
+		return &Head{g.list(d)}
+	case 10:
+		return &length{g.list(d)}
+	case 11:
+		return &Apply{g.r, "f", []Node{g.scalar(d)}}
+	case 12:
+		return &Undef{"fuzzed"}
+	}
+	return g.scalar(0)
+}
+
+// Generates an expression computing a list of integers.
+func (g *generator) list(depth int) Node {
+	if depth <= 0 {
+		if v, ok := g.local(true); ok && g.next(2) == 0 {
+			return v
+		}
+		return EmptyList{}
+	}
+	d := depth - 1
+	switch g.next(8) {
+	case 0, 1:
+		return &Prepend{g.scalar(d), g.list(d)}
+	case 2:
+		return &Tail{g.list(d)}
+	case 3:
+		return &If{g.scalar(d), g.list(d), g.list(d)}
+	case 4:
+		return g.let(depth, true)
+	}
+	return g.list(0)
+}
+
+// Generates the type of an argument: a small range of integers, or a list of
+// them.
+func (g *generator) arg(list bool) Type {
+	lo := g.next(41) - 20
+	t := Type{Range: Range{lo, lo + g.next(21)}}
+	if list {
+		n, elem := g.next(4), t
+		t = Type{Range: Range{n, n + g.next(4)}, Elem: &elem}
+	}
+	return t
+}
+
+// Returns true if o is one of the values of t.
+func member(t Type, o Obj) bool {
+	if t.Elem != nil {
+		if o.Vals == nil || !t.ranges().contains(len(o.Vals)) {
+			return false
+		}
+		for i, v := range o.Vals {
+			if !member(t.at(i), v) {
+				return false
+			}
+		}
+		return true
+	} else if o.Vals != nil {
+		return false
+	}
+
+	// The analysis only tells apart values that fit in an int32.
+	if o.Int <= math.MinInt32 {
+		return t.Start == math.MinInt32
+	} else if o.Int >= math.MaxInt32 {
+		return t.End == math.MaxInt32
+	}
+	v := int(o.Int)
+	c := t.congruence()
+	return t.ranges().contains(v) && (c.Mod == 1 ||
+		c.Mod == 0 && v == c.Rem || c.Mod > 1 && ((v-c.Rem)%c.Mod+c.Mod)%c.Mod == 0)
+}
+
+// Raised when a generated program computes an integer that might overflow
+// once used, which the analysis (working with unbounded integers) doesn't
+// model.
+var errOverflow = errors.New("integer overflow")
+
+// Evaluates Node, raising errOverflow if the result is too large to compute
+// with safely.
+type watched struct{ Node }
+
+// Evaluates the watched node.
+func (w watched) Eval(args []Obj) Obj {
+	o := w.Node.Eval(args)
+	if o.Vals == nil && (o.Int <= math.MinInt32 || o.Int >= math.MaxInt32) {
+		panic(errOverflow)
+	}
+	return o
+}
+
+// Returns a copy of n whose every part is watched, calling functions in r.
+func watch(n Node, r *Runtime) Node {
+	switch n := n.(type) {
+	case *Plus:
+		return watched{&Plus{watch(n.A, r), watch(n.B, r)}}
+	case *Times:
+		return watched{&Times{watch(n.A, r), watch(n.B, r)}}
+	case *Divide:
+		return watched{&Divide{watch(n.A, r), watch(n.B, r)}}
+	case *Modulo:
+		return watched{&Modulo{watch(n.A, r), watch(n.B, r)}}
+	case *Compare:
+		return watched{&Compare{n.Op, watch(n.A, r), watch(n.B, r)}}
+	case *Negate:
+		return watched{&Negate{watch(n.Elem, r)}}
+	case *If:
+		return watched{&If{watch(n.Cond, r), watch(n.NonPositive, r),
+			watch(n.Positive, r)}}
+	case *Let:
+		return watched{&Let{n.Index, watch(n.Value, r), watch(n.Body, r)}}
+	case *Prepend:
+		return watched{&Prepend{watch(n.Head, r), watch(n.Tail, r)}}
+	case *Head:
+		return watched{&Head{watch(n.List, r)}}
+	case *Tail:
+		return watched{&Tail{watch(n.List, r)}}
+	case *length:
+		return watched{&length{watch(n.List, r)}}
+	case *Apply:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = watch(arg, r)
+		}
+		return watched{&Apply{r, n.Name, args}}
+	}
+	return watched{n}
+}
+
+// Evaluates n, returning what it panicked with (if anything) and whether it
+// recursed too deeply (or computed too large a number) to tell.
+func evaluate(n Node, args []Obj) (result Obj, failure interface{}, skip bool) {
+	defer func() {
+		if p := recover(); p == errTooDeep || p == errOverflow {
+			skip = true
+		} else if p != nil {
+			failure = p
+		}
+	}()
+	return n.Eval(args), nil, false
+}
+
+// Checks that whenever Type finds a generated program cannot fail, running it
+// on values drawn from its arguments' types gives a result of the type found.
+// Run with go test -fuzz FuzzEvalAgainstType; inputs that once failed are
+// kept in testdata.
+func FuzzEvalAgainstType(f *testing.F) {
+	f.Add([]byte{0, 1, 2})
+	f.Add([]byte{1, 9, 0, 1, 1, 20, 3, 11, 2, 6, 5, 0, 4, 7})
+	f.Add([]byte{0, 0, 5, 2, 3, 9, 0, 1, 16, 0, 1, 0, 0, 3, 2, 1, 1})
+	f.Add([]byte{2, 1, 10, 4, 0, 3, 1, 9, 2, 18, 2, 0, 8, 1, 4, 6, 3, 0, 1})
+	f.Add([]byte{1, 1, 1, 11, 6, 3, 5, 0, 11, 0, 12, 4, 2, 8, 17, 5, 2, 1})
+	f.Add([]byte{13, 0, 0, 0, 1, 5, 10, 11, 13, 0, 0, 1, 7, 1})
+	f.Add([]byte{0, 13, 0, 0, 13, 0, 0, 0, 0, 3, 2, 1, 1, 6, 0, 0, 3, 0, 0, 13, 0, 0,
+		0, 0, 0, 6, 0, 3, 2})
+	f.Add([]byte{6, 4, 1, 1, 0, 0, 0, 0, 1, 8, 0, 0, 0, 0, 1, 6, 13, 0, 1, 9, 6, 4, 4,
+		13, 0, 0, 13, 0, 1, 10, 9, 7, 13, 0, 0, 0, 11, 0, 0, 0, 0, 1, 8, 13, 0, 1, 10, 0,
+		1, 23, 0, 11, 13, 0, 0, 1, 4, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := &Runtime{}
+		g := &generator{data: data, r: r}
+
+		// f takes one integer; main up to three of either kind.
+		g.lists = []bool{false}
+		r.Funcs = map[string]Node{"f": g.scalar(fuzzDepth)}
+		r.arity = map[string]int{"f": 1}
+		g.lists = make([]bool, 1+g.next(3))
+		args := make([]Type, len(g.lists))
+		for i := range g.lists {
+			g.lists[i] = g.next(3) == 0
+			args[i] = g.arg(g.lists[i])
+		}
+		main := g.scalar(fuzzDepth)
+		if g.next(2) == 0 {
+			main = g.list(fuzzDepth)
+		}
+		r.Funcs["main"] = main
+
+		// Whatever data is left chooses how main is analysed.
+		opts := g.next(8)
+		r.Relational = opts&1 != 0
+		r.Prefixes = opts&2 != 0
+		r.Sensitivity = g.next(3)
+		if opts&4 != 0 {
+			r.Summarize("f") // f need not have a summary
+		}
+		typ, err := r.call("main", args)
+		if err != nil {
+			return
+		}
+
+		// Run a copy, so that the analysis sees only the program.
+		run := &Runtime{maxDepth: fuzzCalls}
+		run.Funcs = map[string]Node{"f": watch(r.Funcs["f"], run)}
+		checked := watch(main, run)
+
+		rnd := rand.New(rand.NewSource(int64(len(data))))
+		values := make([][]Obj, len(args))
+		for i, arg := range args {
+			values[i] = samples(arg, rnd)
+		}
+		for i := 0; i < fuzzSamples; i++ {
+			objs := make([]Obj, len(args))
+			for j := range objs {
+				objs[j] = values[j][rnd.Intn(len(values[j]))]
+			}
+			result, failure, skip := evaluate(checked, objs)
+			if skip {
+				continue
+			} else if failure != nil {
+				t.Fatalf("%s failed with %v for %v, but has type %s given %s (f = %s)",
+					main, failure, objs, typ, typesString(args), r.Funcs["f"])
+			} else if !member(typ, result) {
+				t.Fatalf("%s gave %s for %v, outside its type %s given %s (f = %s)",
+					main, result, objs, typ, typesString(args), r.Funcs["f"])
+			}
+		}
+	})
+}
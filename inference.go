@@ -3,6 +3,7 @@ package madison
 import (
 	"errors"
 	"fmt"
+	"math"
 )
 
 // Compute the type of this constant.
@@ -11,9 +12,9 @@ func (c Const) Type(cs []CallSite, lcl []Type) (Type, error) {
 }
 
 // Attempt to set the type of this constant.
-func (c Const) RestrictTo(locals []Type, t Type) error {
+func (c Const) RestrictTo(cs []CallSite, locals []Type, t Type) error {
 	if t.Elem != nil || t.Range.Start > int(c) || t.Range.End < int(c) {
-		return &Impossible{c, t, Type{Range{int(c), int(c)}, nil}}
+		return &Impossible{c, t, Constant(int(c))}
 	} else {
 		return nil
 	}
@@ -25,9 +26,9 @@ func (e EmptyList) Type(cs []CallSite, lcl []Type) (Type, error) {
 }
 
 // Attempt to set the type of the empty list.
-func (e EmptyList) RestrictTo(locals []Type, t Type) error {
-	if t.Elem == nil || t.Elem.Range.Start != 0 || t.Elem.Range.End != 0 {
-		return &Impossible{e, t, Type{Range{0, 0}, &Type{Range: UNDEF}}}
+func (e EmptyList) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	if t.Elem == nil || t.Range.Start > 0 || t.Range.End < 0 {
+		return &Impossible{e, t, Type{Range: Range{0, 0}, Elem: &Type{Range: UNDEF}}}
 	} else {
 		return nil
 	}
@@ -46,26 +47,42 @@ func (p *Plus) Type(cs []CallSite, lcl []Type) (Type, error) {
 	if a.Elem != nil {
 		fmt.Printf("can't add lists")
 	}
-	return Type{Range: conv(a.Range, b.Range)}, nil
+	t := strided(typeOf(a.ranges().add(b.ranges())),
+		congruenceSum(a.congruence(), b.congruence()))
+	if la, ok := linearOf(p.A); ok && runtimeOf(cs).relational() {
+		if lb, ok := linearOf(p.B); ok {
+			if r, ok := combine(lcl, la, lb); ok {
+				if s := t.ranges().intersect(RangeSet{r}); len(s) > 0 {
+					t = t.withRanges(s)
+				}
+			}
+		}
+	}
+	return t, nil
 }
 
 // Attempt to set the type of the sum of the arguments.
-func (p *Plus) RestrictTo(locals []Type, t Type) error {
+func (p *Plus) RestrictTo(cs []CallSite, locals []Type, t Type) error {
 	// Try to set A to T - B
-	b, err := p.B.Type([]CallSite{}, locals)
+	b, err := p.B.Type(cs, locals)
 	if err != nil {
 		return err
 	}
-	aerr := p.A.RestrictTo(locals,
-		Type{Range: conv(t.Range, inverse(b.Range))})
+	aerr := p.A.RestrictTo(cs, locals, difference(t, b))
 
 	// Try to set B to T - A
-	a, err := p.A.Type([]CallSite{}, locals)
+	a, err := p.A.Type(cs, locals)
 	if err != nil {
 		return err
 	}
-	berr := p.B.RestrictTo(locals,
-		Type{Range: conv(t.Range, inverse(a.Range))})
+	berr := p.B.RestrictTo(cs, locals, difference(t, a))
+
+	// Relate A and B, if they are both locals.
+	if la, ok := linearOf(p.A); ok && runtimeOf(cs).relational() {
+		if lb, ok := linearOf(p.B); ok && !constrain(locals, la, lb, t.Range) {
+			return &Impossible{p, t, a}
+		}
+	}
 
 	if aerr != nil {
 		return berr
@@ -74,6 +91,239 @@ func (p *Plus) RestrictTo(locals []Type, t Type) error {
 	}
 }
 
+// Compute the type of the product of the two arguments.
+func (m *Times) Type(cs []CallSite, lcl []Type) (Type, error) {
+	a, err := m.A.Type(cs, lcl)
+	if err != nil {
+		return a, err
+	}
+	b, err := m.B.Type(cs, lcl)
+	if err != nil {
+		return b, err
+	}
+	if a.Elem != nil {
+		return NIL, fmt.Errorf("cannot multiply a %s", a)
+	} else if b.Elem != nil {
+		return NIL, fmt.Errorf("cannot multiply a %s", b)
+	}
+	return strided(Type{Range: mul(a.Range, b.Range)},
+		congruenceProduct(a.congruence(), b.congruence())), nil
+}
+
+// Attempt to set the type of the product of the arguments.
+func (m *Times) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	a, err := m.A.Type(cs, locals)
+	if err != nil {
+		return err
+	}
+	b, err := m.B.Type(cs, locals)
+	if err != nil {
+		return err
+	}
+
+	// Try to set A to T / B
+	f := factor(t.Range, b.Range)
+	if len(f) == 0 {
+		return &Impossible{m, t, Type{Range: mul(a.Range, b.Range)}}
+	}
+	if err := m.A.RestrictTo(cs, locals, Type{Range: f[0]}); err != nil {
+		return err
+	}
+
+	// Try to set B to T / A
+	if a, err = m.A.Type(cs, locals); err != nil {
+		return err
+	}
+	f = factor(t.Range, a.Range)
+	if len(f) == 0 {
+		return &Impossible{m, t, Type{Range: mul(a.Range, b.Range)}}
+	}
+	return m.B.RestrictTo(cs, locals, Type{Range: f[0]})
+}
+
+// Computes the types of both sides of a division, making sure the divisor
+// cannot be zero.
+func divisionTypes(n, x, y Node, cs []CallSite, lcl []Type) (a, b Type, err error) {
+	if a, err = x.Type(cs, lcl); err != nil {
+		return
+	}
+	if b, err = y.Type(cs, lcl); err != nil {
+		return
+	}
+	if a.Elem != nil {
+		err = fmt.Errorf("cannot divide a %s", a)
+	} else if b.Elem != nil {
+		err = fmt.Errorf("cannot divide by a %s", b)
+	} else if b.ranges().contains(0) {
+		err = &DivideByZero{n, b}
+	}
+	return
+}
+
+// Computes the quotient of a divided by b, which must not contain zero, one
+// piece of b at a time.
+func quotient(a, b Type) Type {
+	var qs []Range
+	for _, r := range b.ranges() {
+		qs = append(qs, quo(a.Range, r))
+	}
+	return typeOf(Ranges(qs...))
+}
+
+// Compute the type of the quotient of the two arguments.
+func (d *Divide) Type(cs []CallSite, lcl []Type) (Type, error) {
+	a, b, err := divisionTypes(d, d.A, d.B, cs, lcl)
+	if err != nil {
+		return NIL, err
+	}
+	return quotient(a, b), nil
+}
+
+// Attempt to set the type of the quotient of the arguments.
+func (d *Divide) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	a, b, err := divisionTypes(d, d.A, d.B, cs, locals)
+	if err != nil {
+		return err
+	}
+	q := quotient(a, b)
+	if len(q.ranges().intersect(t.ranges())) == 0 {
+		return &Impossible{d, t, q}
+	}
+
+	// A = T * B + R, where |R| < |B|.
+	m := abs(b.Start)
+	if abs(b.End) > m {
+		m = abs(b.End)
+	}
+	spread := UNDEF
+	if m < math.MaxInt32 {
+		spread = Range{1 - m, m - 1}
+	}
+	return d.A.RestrictTo(cs, locals, Type{Range: conv(mul(t.Range, b.Range), spread)})
+}
+
+// Compute the type of the remainder of the two arguments.
+func (m *Modulo) Type(cs []CallSite, lcl []Type) (Type, error) {
+	a, b, err := divisionTypes(m, m.A, m.B, cs, lcl)
+	if err != nil {
+		return NIL, err
+	}
+	return remainder(a, b), nil
+}
+
+// Attempt to set the type of the remainder of the arguments.
+func (m *Modulo) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	a, b, err := divisionTypes(m, m.A, m.B, cs, locals)
+	if err != nil {
+		return err
+	}
+	r := remainder(a, b)
+	if len(r.ranges().intersect(t.ranges())) == 0 {
+		return &Impossible{m, t, r}
+	}
+
+	// A = Q * B + R, so A is R modulo B.
+	if b.Set == nil && b.IsConst() && t.Set == nil && t.IsConst() {
+		err := m.A.RestrictTo(cs, locals,
+			Type{Range: UNDEF, Stride: makeCongruence(b.Start, t.Start)})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The remainder has the same sign as A, and is no larger.
+	if t.Start > 0 {
+		return m.A.RestrictTo(cs, locals, InRange(t.Start, math.MaxInt32))
+	} else if t.End < 0 {
+		return m.A.RestrictTo(cs, locals, InRange(math.MinInt32, t.End))
+	}
+	return nil
+}
+
+// Computes the types of both sides of a comparison.
+func (c *Compare) operands(cs []CallSite, lcl []Type) (a, b Type, err error) {
+	if a, err = c.A.Type(cs, lcl); err != nil {
+		return
+	}
+	if b, err = c.B.Type(cs, lcl); err != nil {
+		return
+	}
+	if a.Elem != nil {
+		err = fmt.Errorf("cannot compare a %s", a)
+	} else if b.Elem != nil {
+		err = fmt.Errorf("cannot compare a %s", b)
+	}
+	return
+}
+
+// Compute the type of this comparison.
+func (c *Compare) Type(cs []CallSite, lcl []Type) (Type, error) {
+	a, b, err := c.operands(cs, lcl)
+	if err != nil {
+		return NIL, err
+	}
+	t := InRange(0, 1)
+	if _, _, ok := compare(c.Op, a.ranges(), b.ranges()); !ok {
+		t.End = 0
+	}
+	if _, _, ok := compare(negations[c.Op], a.ranges(), b.ranges()); !ok {
+		t.Start = 1
+	}
+
+	// Use what is known about A - B, if they are both locals.
+	if d, ok := c.difference(lcl); ok && runtimeOf(cs).relational() {
+		if _, _, ok := compare(c.Op, d, RangeSet{{0, 0}}); !ok {
+			t.End = 0
+		}
+		if _, _, ok := compare(negations[c.Op], d, RangeSet{{0, 0}}); !ok {
+			t.Start = 1
+		}
+	}
+	return t, nil
+}
+
+// Attempt to set the type of this comparison, narrowing both arguments.
+func (c *Compare) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	a, b, err := c.operands(cs, locals)
+	if err != nil {
+		return err
+	}
+	op := c.Op
+	switch {
+	case t.Elem != nil || t.Start > 1 || t.End < 0:
+		return &Impossible{c, t, InRange(0, 1)}
+	case t.Start <= 0 && t.End >= 1:
+		return nil // either outcome will do
+	case t.End < 1:
+		op = negations[op]
+	}
+
+	ar, br, ok := compare(op, a.ranges(), b.ranges())
+	if !ok {
+		found, _ := c.Type(cs, locals)
+		return &Impossible{c, t, found}
+	}
+	if err := c.A.RestrictTo(cs, locals, typeOf(ar)); err != nil {
+		return err
+	}
+	if err := c.B.RestrictTo(cs, locals, typeOf(br)); err != nil {
+		return err
+	}
+
+	// Relate A and B, if they are both locals.
+	if d, ok := c.difference(locals); ok && runtimeOf(cs).relational() {
+		if _, _, ok := compare(op, d, RangeSet{{0, 0}}); !ok {
+			return &Impossible{c, t, InRange(0, 1)}
+		}
+		la, _ := linearOf(c.A)
+		lb, _ := linearOf(c.B)
+		if !constrain(locals, la, lb.negated(), differences(op)) {
+			return &Impossible{c, t, InRange(0, 1)}
+		}
+	}
+	return nil
+}
+
 // Compute the type of this negation.
 func (n *Negate) Type(cs []CallSite, lcl []Type) (Type, error) {
 	typ, err := n.Elem.Type(cs, lcl)
@@ -83,33 +333,48 @@ func (n *Negate) Type(cs []CallSite, lcl []Type) (Type, error) {
 	if typ.Elem != nil {
 		return NIL, fmt.Errorf("cannot negate a %s", typ)
 	}
-	return Type{
-		Range: inverse(typ.Range),
-	}, nil
+	return strided(typeOf(typ.ranges().negate()),
+		congruenceNegation(typ.congruence())), nil
 }
 
 // Attempt to set the type of the negation.
-func (n *Negate) RestrictTo(locals []Type, t Type) error {
+func (n *Negate) RestrictTo(cs []CallSite, locals []Type, t Type) error {
 	if t.Elem != nil {
 		return errors.New("negating an array is not supported yet")
 	}
 
-	t.Range = inverse(t.Range)
-	return n.Elem.RestrictTo(locals, t)
+	return n.Elem.RestrictTo(cs, locals, strided(typeOf(t.ranges().negate()),
+		congruenceNegation(t.congruence())))
 }
 
 // Compute the type of this variable reference.
 func (v *Var) Type(cs []CallSite, lcl []Type) (Type, error) {
-	return lcl[v.index], nil
+	t := lcl[v.index]
+	t.rel = nil
+	return t, nil
 }
 
 // Attempt to set the type of this variable.
-func (v *Var) RestrictTo(locals []Type, t Type) error {
-	intr := intersect(locals[v.index].Range, t.Range)
+func (v *Var) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	intr := locals[v.index].ranges().intersect(t.ranges())
 	if len(intr) == 0 {
 		return &Impossible{v, t, locals[v.index]}
 	}
-	locals[v.index].Range = intr[0]
+	c, ok := congruenceMeet(locals[v.index].congruence(), t.congruence())
+	if !ok {
+		return &Impossible{v, t, locals[v.index]}
+	}
+	typ, ok := locals[v.index].withRanges(intr).withStride(c)
+	if ok && typ.Elem != nil && t.Elem != nil {
+		typ, ok = meetElems(typ, t)
+	}
+	if !ok {
+		return &Impossible{v, t, locals[v.index]}
+	}
+	locals[v.index] = typ
+	if !propagate(locals, v.index) {
+		return &Impossible{v, t, typ}
+	}
 	return nil
 }
 
@@ -119,21 +384,26 @@ func (i *If) Type(cs []CallSite, lcl []Type) (Type, error) {
 		lte Type
 		gte Type
 	)
+	if _, err := i.Cond.Type(cs, lcl); err != nil {
+		return NIL, err
+	}
 
 	// <= 0 case:
 	copy := append([]Type(nil), lcl...)
-	lerr := i.Cond.RestrictTo(copy, NON_POSITIVE)
+	lerr := i.Cond.RestrictTo(cs, copy, NON_POSITIVE)
 	if lerr == nil {
-		if lte, lerr = i.NonPositive.Type(cs, copy); lerr != nil {
+		lte, lerr = i.NonPositive.Type(cs, copy)
+		if lerr != nil && lerr != errDiverges {
 			return NIL, lerr
 		}
 	}
 
 	// >0 case:
 	copy = append([]Type(nil), lcl...)
-	gerr := i.Cond.RestrictTo(copy, POSITIVE)
+	gerr := i.Cond.RestrictTo(cs, copy, POSITIVE)
 	if gerr == nil {
-		if gte, gerr = i.Positive.Type(cs, copy); gerr != nil {
+		gte, gerr = i.Positive.Type(cs, copy)
+		if gerr != nil && gerr != errDiverges {
 			return NIL, gerr
 		}
 	}
@@ -142,66 +412,174 @@ func (i *If) Type(cs []CallSite, lcl []Type) (Type, error) {
 		return TypesUnion(lte, gte)
 	} else if lerr == nil {
 		return lte, nil
+	} else if gerr == nil {
+		return gte, nil
+	} else if lerr == errDiverges || gerr == errDiverges {
+		return NIL, errDiverges
 	} else {
 		return gte, gerr
 	}
 }
 
-// Attempt to set the type of this conditional.
-func (i *If) RestrictTo(locals []Type, t Type) error {
-	copy := append([]Type(nil), locals...)
-	if err := i.Cond.RestrictTo(copy, NON_POSITIVE); err == nil {
-		if err := i.NonPositive.RestrictTo(copy, t); err == nil {
-			if err := i.Cond.RestrictTo(locals, NON_POSITIVE); err != nil {
-				return err
-			}
-		}
+// Attempt to set the type of this conditional, keeping whatever either
+// branch allows.
+func (i *If) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	lte := append([]Type(nil), locals...)
+	lerr := i.Cond.RestrictTo(cs, lte, NON_POSITIVE)
+	if lerr == nil {
+		lerr = i.NonPositive.RestrictTo(cs, lte, t)
 	}
 
-	copy = append([]Type(nil), locals...)
-	if err := i.Cond.RestrictTo(copy, POSITIVE); err == nil {
-		if err := i.Positive.RestrictTo(copy, t); err == nil {
-			if err := i.Cond.RestrictTo(locals, POSITIVE); err != nil {
+	gte := append([]Type(nil), locals...)
+	gerr := i.Cond.RestrictTo(cs, gte, POSITIVE)
+	if gerr == nil {
+		gerr = i.Positive.RestrictTo(cs, gte, t)
+	}
+
+	switch {
+	case lerr != nil && gerr != nil:
+		return lerr
+	case lerr != nil:
+		copy(locals, gte)
+	case gerr != nil:
+		copy(locals, lte)
+	default:
+		for k := range locals {
+			u, err := TypesUnion(lte[k], gte[k])
+			if err != nil {
 				return err
 			}
+			locals[k] = u
 		}
 	}
+	return nil
+}
 
+// Checks that the call passes as many arguments as the function takes, where
+// that is known (it isn't checked for files that are yet to be resolved).
+func (a *Apply) arity() error {
+	if k, ok := a.Runtime.arity[a.Name]; ok && k != len(a.Args) {
+		return fmt.Errorf("%s takes %d arguments, got %d", a.Name, k, len(a.Args))
+	}
 	return nil
 }
 
+// Returns the most recent calls in callers that r tells calls apart by (see
+// Sensitivity), which is as much of the chain as errors report.
+func (r *Runtime) context(callers []CallSite) []CallSite {
+	if k := r.Sensitivity; k > 0 && len(callers) > k {
+		return callers[len(callers)-k:]
+	}
+	return callers
+}
+
 // Compute the type of this function call.
 func (a *Apply) Type(cs []CallSite, locals []Type) (Type, error) {
-	arg, err := a.Arg.Type(cs, locals)
-	if err != nil {
-		return NIL, err
+	args := make([]Type, len(a.Args))
+	for i, arg := range a.Args {
+		typ, err := arg.Type(cs, locals)
+		if err != nil {
+			return NIL, err
+		}
+		args[i] = typ
 	}
+	return a.call(cs, args)
+}
 
+// Computes the type of this function call, given the types of its arguments.
+func (a *Apply) call(cs []CallSite, args []Type) (Type, error) {
 	funct, ok := a.Runtime.Funcs[a.Name]
 	if !ok {
 		return NIL, fmt.Errorf("undefined function %s", a.Name)
 	}
+	if err := a.arity(); err != nil {
+		return NIL, err
+	}
+
+	if sig, ok := a.Runtime.Signatures[a.Name]; ok {
+		typ, err := sig.apply(args)
+		if err != nil {
+			site := CallSite{Name: a.Name, Args: args, Context: a, runtime: a.Runtime}
+			return NIL, &CallError{a.Runtime.context(append(cs[:len(cs):len(cs)], site)), err}
+		}
+		return typ, nil
+	} else if sym, ok := a.Runtime.Symbolic[a.Name]; ok {
+		if typ, fits, err := a.summarized(sym, funct, cs, args); fits {
+			return typ, err
+		}
+	}
+
+	limit := unrollLimit
+	if k := a.Runtime.Sensitivity; k > 0 && k < limit {
+		limit = k
+	}
+	if i := loopHead(cs, a.Name, args, limit); i >= 0 {
+		for _, site := range cs[i+1:] {
+			if site.frame != nil {
+				site.frame.provisional = true
+			}
+		}
+		return cs[i].frame.reenter(args)
+	}
+
+	// The whole chain is kept, so that recursion through other functions is
+	// still caught; only errors are cut down to the context.
+	f := &frame{args: args}
+	callers := append(cs[:len(cs):len(cs)],
+		CallSite{Name: a.Name, Args: args, Context: a, frame: f, runtime: a.Runtime})
+
+	if s, ok := a.Runtime.summary(a.Name, args); ok {
+		return s.replay(callers)
+	}
 
-	return funct.Type(cs, []Type{arg})
+	typ, err := f.solve(funct, callers)
+	if err != nil {
+		if _, ok := err.(*CallError); !ok && err != errDiverges {
+			err = &CallError{a.Runtime.context(callers), err}
+		}
+		typ = NIL
+	}
+	if !f.provisional {
+		a.Runtime.remember(a.Name, args, callers, typ, err)
+	}
+	return typ, err
 }
 
 // Attempt to set the type of this function call.
-func (a *Apply) RestrictTo(locals []Type, t Type) error {
-	arg, err := a.Arg.Type([]CallSite{}, locals)
-	if err != nil {
-		return err
+func (a *Apply) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	for _, site := range cs {
+		if site.restricting && site.Name == a.Name {
+			return nil // recursive calls are left as they are
+		}
+	}
+	lcls := make([]Type, len(a.Args))
+	for i, arg := range a.Args {
+		typ, err := arg.Type(cs, locals)
+		if err != nil {
+			return err
+		}
+		lcls[i] = typ
 	}
 
 	funct, ok := a.Runtime.Funcs[a.Name]
 	if !ok {
 		return fmt.Errorf("undefined function %#v\n", a.Name)
 	}
+	if err := a.arity(); err != nil {
+		return err
+	}
 
-	lcls := []Type{arg}
-	if err := funct.RestrictTo(lcls, t); err != nil {
+	site := CallSite{Name: a.Name, Args: lcls, Context: a, restricting: true,
+		runtime: a.Runtime}
+	if err := funct.RestrictTo(append(cs[:len(cs):len(cs)], site), lcls, t); err != nil {
 		return err
 	}
-	return a.Arg.RestrictTo(locals, lcls[0])
+	for i, arg := range a.Args {
+		if err := arg.RestrictTo(cs, locals, lcls[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Compute the type of this prepend call.
@@ -217,28 +595,24 @@ func (p *Prepend) Type(cs []CallSite, locals []Type) (Type, error) {
 	if t.Elem == nil {
 		return NIL, fmt.Errorf("%s is not a list type", t)
 	}
-	m := h
-	if t.Range.End > 0 {
-		if m, err = TypesUnion(h, *t.Elem); err != nil {
-			return NIL, err
-		}
+	l := prepend(h, t)
+	if !runtimeOf(cs).prefixes() {
+		l.Prefix = nil
 	}
-	return Type{
-		Range: conv(Range{1, 1}, t.Range),
-		Elem:  &m,
-	}, nil
+	return l, nil
 }
 
 // Attempt to set the type of this prepend call.
-func (p *Prepend) RestrictTo(locals []Type, t Type) error {
-	if t.Elem != nil || t.Elem.Start < 1 {
-		return &Impossible{p, t, Type{Range{1, 1}, &Type{}}}
+func (p *Prepend) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	lengths := t.ranges().intersect(RangeSet{POSITIVE.Range})
+	if t.Elem == nil || len(lengths) == 0 {
+		return &Impossible{p, t, nonEmpty}
 	}
-	if err := p.Head.RestrictTo(locals, *t.Elem); err != nil {
+	t = t.withRanges(lengths)
+	if err := p.Head.RestrictTo(cs, locals, t.at(0)); err != nil {
 		return err
 	}
-	t.Range.Start -= 1
-	return p.Tail.RestrictTo(locals, t)
+	return p.Tail.RestrictTo(cs, locals, t.rest())
 }
 
 // Compute the type of the first element of the list.
@@ -251,12 +625,16 @@ func (h *Head) Type(cs []CallSite, locals []Type) (Type, error) {
 	} else if typ.Range.Start < 1 {
 		return NIL, fmt.Errorf("cannot take head of an empty list: %s", typ)
 	}
-	return *typ.Elem, nil
+	return typ.at(0), nil
 }
 
 // Attempt to set the type of the first element of this list.
-func (h *Head) RestrictTo(locals []Type, t Type) error {
-	return h.List.RestrictTo(locals, Type{Range: POSITIVE.Range, Elem: &t})
+func (h *Head) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	list := Type{Range: POSITIVE.Range, Elem: &Type{Range: UNDEF}}
+	if runtimeOf(cs).prefixes() {
+		list.Prefix = []Type{t}
+	}
+	return h.List.RestrictTo(cs, locals, list)
 }
 
 // Compute the type of the remaining elements of the list.
@@ -264,21 +642,114 @@ func (t *Tail) Type(cs []CallSite, locals []Type) (Type, error) {
 	typ, err := t.List.Type(cs, locals)
 	if err != nil {
 		return NIL, err
-	} else if typ.Elem != nil {
+	} else if typ.Elem == nil {
 		return NIL, fmt.Errorf("element is not a list type: %s", typ)
 	} else if typ.Range.Start < 1 {
 		return NIL, fmt.Errorf("cannot take tail of an empty list: %s", typ)
 	}
-	return *typ.Elem, nil
+	return typ.rest(), nil
 }
 
 // Attempt to set the type of the remaining elements of the list.
-func (t *Tail) RestrictTo(locals []Type, typ Type) error {
-	if typ.Elem != nil {
-		return fmt.Errorf("element is not a list type: %s", typ)
+func (t *Tail) RestrictTo(cs []CallSite, locals []Type, typ Type) error {
+	lengths := typ.ranges().intersect(RangeSet{{0, math.MaxInt32}})
+	if typ.Elem == nil || len(lengths) == 0 {
+		return &Impossible{t, typ, Type{Range: Range{0, math.MaxInt32},
+			Elem: &Type{Range: UNDEF}}}
+	}
+	list := Type{Elem: &Type{Range: UNDEF}}.withRanges(lengths.add(RangeSet{{1, 1}}))
+	if runtimeOf(cs).prefixes() {
+		list.Prefix = []Type{{Range: UNDEF}}
+		for i := 0; i+1 < maxPrefix; i++ {
+			list.Prefix = append(list.Prefix, typ.at(i))
+		}
+	}
+	return t.List.RestrictTo(cs, locals, trimPrefix(list))
+}
+
+// Compute the type of the number of elements in the list.
+func (l *length) Type(cs []CallSite, locals []Type) (Type, error) {
+	typ, err := l.List.Type(cs, locals)
+	if err != nil {
+		return NIL, err
+	} else if typ.Elem == nil {
+		return NIL, fmt.Errorf("element is not a list type: %s", typ)
+	}
+	return Type{Range: typ.Range}, nil
+}
+
+// Attempt to set the number of elements in the list.
+func (l *length) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	lengths := t.ranges().intersect(RangeSet{{0, math.MaxInt32}})
+	if t.Elem != nil || len(lengths) == 0 {
+		return &Impossible{l, t, Type{Range: Range{0, math.MaxInt32}}}
+	}
+	return l.List.RestrictTo(cs, locals, Type{Elem: &Type{Range: UNDEF}}.withRanges(lengths))
+}
+
+// Compute the type of the body with the bound variable.
+func (l *Let) Type(cs []CallSite, locals []Type) (Type, error) {
+	v, err := l.Value.Type(cs, locals)
+	if err != nil {
+		return NIL, err
+	}
+	lcls := make([]Type, l.scope(len(locals)))
+	copy(lcls, locals)
+	unrelate(lcls, l.Index)
+	lcls[l.Index] = v
+	return l.Body.Type(cs, lcls)
+}
+
+// Attempt to set the type of the body, narrowing the bound value too.
+func (l *Let) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	v, err := l.Value.Type(cs, locals)
+	if err != nil {
+		return err
+	}
+	lcls := make([]Type, l.scope(len(locals)))
+	copy(lcls, locals)
+	unrelate(lcls, l.Index)
+	lcls[l.Index] = v
+	if err := l.Body.RestrictTo(cs, lcls, t); err != nil {
+		return err
+	}
+	unrelate(lcls, l.Index)
+	for i := range locals {
+		if i != l.Index {
+			locals[i] = lcls[i]
+		}
+	}
+	return l.Value.RestrictTo(cs, locals, lcls[l.Index])
+}
+
+// Compute the type of the located node, noting where any error happened.
+func (l *Located) Type(cs []CallSite, locals []Type) (Type, error) {
+	if l.runtime != nil && runtimeOf(cs) != l.runtime {
+		cs = within(cs, l.runtime)
+	}
+	typ, err := l.Node.Type(cs, locals)
+	return typ, l.locate(err)
+}
+
+// Attempt to set the type of the located node, noting where any error
+// happened.
+func (l *Located) RestrictTo(cs []CallSite, locals []Type, t Type) error {
+	if l.runtime != nil && runtimeOf(cs) != l.runtime {
+		cs = within(cs, l.runtime)
+	}
+	return l.locate(l.Node.RestrictTo(cs, locals, t))
+}
+
+// Adds the position of this node to err, unless a more specific one is known.
+func (l *Located) locate(err error) error {
+	switch err.(type) {
+	case nil, *PosError, *CallError:
+		return err
+	}
+	if err == errDiverges {
+		return err
 	}
-	typ.Range.Start -= 1
-	return t.List.RestrictTo(locals, typ)
+	return &PosError{l.Span, err}
 }
 
 // Raises a pattern match failure.
@@ -287,6 +758,6 @@ func (t *Undef) Type(cs []CallSite, locals []Type) (Type, error) {
 }
 
 // Raises a pattern match failure.
-func (t *Undef) RestrictTo(locals []Type, typ Type) error {
+func (t *Undef) RestrictTo(cs []CallSite, locals []Type, typ Type) error {
 	return errors.New("undefined")
 }
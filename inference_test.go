@@ -3,6 +3,7 @@ package madison_test
 import (
 	"fmt"
 	. "github.com/fatlotus/madison"
+	"math"
 )
 
 func Example() {
@@ -35,5 +36,513 @@ func Example() {
 	// Output:
 	// fib :: [0, 5] -> int[1, 8]
 	// repeat :: [3, 5] -> [3, 5]int[1, 5]
-	// unsafe raises cannot take head of an empty list: [0]any
+	// unsafe raises 10:12: cannot take head of an empty list: [0]any
+}
+
+func ExampleCallError() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		first xs = head(xs)
+		repeat 0 = []
+		repeat n = n : repeat(n - 1)
+		unsafe n = first(repeat n)
+	`); err != nil {
+		panic(err)
+	}
+
+	// Show which calls led to the unsafe head() call.
+	_, err := r.Funcs["unsafe"].Type(nil, []Type{InRange(0, 3)})
+	fmt.Printf("unsafe raises %s\n", err)
+	// Output:
+	// unsafe raises 2:14: cannot take head of an empty list: [0, 3]int[1, 3], in first([0, 3]int[1, 3])
+}
+
+func Example_recursion() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		fib 0 = 1
+		fib 1 = 1
+		fib n = fib(n - 1) + fib(n - 2)
+
+		count 0 = 0
+		count n = 1 + count(n - 1)
+
+		forever n = forever(n + 1)
+	`); err != nil {
+		panic(err)
+	}
+
+	// Open-ended arguments still give a (less precise) answer.
+	typ, _ := r.Funcs["fib"].Type(nil, []Type{InRange(0, math.MaxInt32)})
+	fmt.Printf("fib :: [0, ∞) -> %s\n", typ)
+
+	typ, _ = r.Funcs["count"].Type(nil, []Type{InRange(0, 1000000)})
+	fmt.Printf("count :: [0, 1000000] -> %s\n", typ)
+
+	// A literal pattern matches anything no larger, so this stops.
+	fmt.Printf("count -3 = %s\n", r.Funcs["count"].Eval([]Obj{{Int: -3}}))
+
+	_, err := r.Funcs["forever"].Type(nil, []Type{Constant(0)})
+	fmt.Printf("forever raises %s\n", err)
+	// Output:
+	// fib :: [0, ∞) -> int[1, ∞)
+	// count :: [0, 1000000] -> int[0, ∞)
+	// count -3 = 0
+	// forever raises function never returns
+}
+
+func Example_mutualRecursion() {
+	// Telling calls apart by only the most recent one still notices that f
+	// comes back to itself through g.
+	r := &Runtime{Sensitivity: 1}
+	if err := r.ParseFile(`
+		f 0 = 0
+		f n = g(n - 1) + 1
+
+		g 0 = 0
+		g n = f(n - 1) + 2
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, err := r.Funcs["f"].Type(nil, []Type{InRange(0, math.MaxInt32)})
+	fmt.Printf("f :: [0, ∞) -> %s (%v)\n", typ, err)
+	// Output:
+	// f :: [0, ∞) -> int[0, 1] ∪ [3, 4] ∪ [6, ∞) (<nil>)
+}
+
+func ExampleRuntime_Parse() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		fib 0 = 1
+		fib 1 = 1
+		fib n = fib(n - 1) + fib(n - 2)
+		big = fib 40
+	`); err != nil {
+		panic(err)
+	}
+
+	// Calls are remembered, so this doesn't take 2^40 steps.
+	typ, _ := r.Funcs["big"].Type(nil, []Type{})
+	fmt.Printf("big :: %s\n", typ)
+
+	// Redefining a function forgets anything that depended on it.
+	if err := r.Parse("fib n = 0"); err != nil {
+		panic(err)
+	}
+	typ, _ = r.Funcs["big"].Type(nil, []Type{})
+	fmt.Printf("big :: %s\n", typ)
+	// Output:
+	// big :: 165580141
+	// big :: 0
+}
+
+func ExampleTimes() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		scale x = 4 * x - 1
+		area w, h = w * h
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, _ := r.Funcs["scale"].Type(nil, []Type{InRange(-1, 3)})
+	fmt.Printf("scale :: [-1, 3] -> %s\n", typ)
+	fmt.Printf("scale 3 = %s\n", r.Funcs["scale"].Eval([]Obj{{Int: 3}}))
+
+	typ, _ = r.Funcs["area"].Type(nil, []Type{InRange(-2, 3), InRange(4, 5)})
+	fmt.Printf("area :: [-2, 3], [4, 5] -> %s\n", typ)
+
+	// Output:
+	// scale :: [-1, 3] -> int[-5, 11] ≡ 3 (mod 4)
+	// scale 3 = 11
+	// area :: [-2, 3], [4, 5] -> int[-10, 15]
+}
+
+func ExampleDivideByZero() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		safe x = ifz(x, 0, 100 / x)
+		unsafe x = 100 % x
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, _ := r.Funcs["safe"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("safe :: [0, 10] -> %s\n", typ)
+
+	_, err := r.Funcs["unsafe"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("unsafe raises %s\n", err)
+	// Output:
+	// safe :: [0, 10] -> int[0] ∪ [10, 100]
+	// unsafe raises 3:14: divisor may be zero: int[0, 10], in (100 % x)
+}
+
+func ExampleCompare() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		min x, y = if x < y then x else y
+		clamp x = if x > 10 then 10 else if x < 0 then 0 else x
+		spread x = if x == 3 then 0 else 100 / (x - 3)
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, _ := r.Funcs["clamp"].Type(nil, []Type{InRange(-50, 50)})
+	fmt.Printf("clamp :: [-50, 50] -> %s\n", typ)
+
+	typ, _ = r.Funcs["min"].Type(nil, []Type{InRange(0, 5), InRange(3, 8)})
+	fmt.Printf("min :: [0, 5], [3, 8] -> %s\n", typ)
+
+	typ, _ = r.Funcs["spread"].Type(nil, []Type{InRange(3, 10)})
+	fmt.Printf("spread :: [3, 10] -> %s\n", typ)
+	// Output:
+	// clamp :: [-50, 50] -> int[0, 10]
+	// min :: [0, 5], [3, 8] -> int[0, 5]
+	// spread :: [3, 10] -> int[0] ∪ [14, 100]
+}
+
+func ExampleLet() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		inverse x = if d == 0 then 0 else 100 / d where d = x - 3
+		square x = let y = x - 2 in y * y
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, _ := r.Funcs["inverse"].Type(nil, []Type{InRange(3, 10)})
+	fmt.Printf("inverse :: [3, 10] -> %s\n", typ)
+
+	typ, _ = r.Funcs["square"].Type(nil, []Type{InRange(4, 5)})
+	fmt.Printf("square :: [4, 5] -> %s\n", typ)
+	fmt.Printf("square 5 = %s\n", r.Funcs["square"].Eval([]Obj{{Int: 5}}))
+	// Output:
+	// inverse :: [3, 10] -> int[0] ∪ [14, 100]
+	// square :: [4, 5] -> int[4, 9]
+	// square 5 = 9
+}
+
+func ExamplePosError() {
+	r := &Runtime{}
+	if err := r.ParseNamedFile("lists.mad", `
+		first xs = 1 + head(xs)
+	`); err != nil {
+		panic(err)
+	}
+
+	// Find exactly which call might fail.
+	_, err := r.Funcs["first"].Type(nil, []Type{{Range: Range{0, 3}, Elem: &Type{Range: UNDEF}}})
+	fmt.Printf("first raises %s\n", err)
+	if err, ok := err.(*PosError); ok {
+		fmt.Printf("from %d:%d to %d:%d\n",
+			err.Start.Line, err.Start.Col, err.End.Line, err.End.Col)
+	}
+	// Output:
+	// first raises lists.mad:2:18: cannot take head of an empty list: [0, 3]any
+	// from 2:18 to 2:25
+}
+
+func ExampleRuntime_Check() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		clamp :: [0, 100] -> [0, 10]
+		clamp x = if x > 10 then 10 else x
+
+		grow :: [0, 100] -> [0, 10]
+		grow x = x + 1
+
+		use = clamp 50 + clamp 200
+	`); err != nil {
+		panic(err)
+	}
+	fmt.Println(r.Check())
+
+	r.Signatures["grow"] = Signature{[]Type{InRange(0, 100)}, InRange(1, 101)}
+	fmt.Println(r.Check())
+
+	_, err := r.Funcs["use"].Type(nil, nil)
+	fmt.Println(err)
+	// Output:
+	// grow :: int[0, 100] -> int[0, 10], but it may return int[1, 101]
+	// <nil>
+	// arguments 200 are outside the declared int[0, 100], in clamp(200)
+}
+
+func ExampleRuntime_Summarize() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		repeat 0 = []
+		repeat n = n : repeat(n - 1)
+
+		pair a, b = (a + b) : (a - b) : []
+		use n = repeat (n + 2)
+		square n = n * n
+	`); err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"repeat", "pair", "square"} {
+		sym, err := r.Summarize(name)
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("%s :: %s\n", name, sym)
+		}
+	}
+	fmt.Println(r.Symbolic["repeat"].At([]Type{InRange(3, 5)}))
+	fmt.Println(r.Symbolic["repeat"].At([]Type{Constant(0)}))
+
+	typ, _ := r.Funcs["use"].Type(nil, []Type{InRange(0, 1000)})
+	fmt.Println(typ)
+	// Output:
+	// repeat :: [x]int[1, x]
+	// pair :: [2]int[x - y, x + y]
+	// square :: 9x - 20 fails for 6
+	// [3, 5]int[1, 5]
+	// [0]any
+	// [2, 1002]int[1, 1002]
+}
+
+func ExampleRuntime_Summarize_unchecked() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		g n = if n < 2 then head [] else n
+		useg = g 0
+		f n = if n < 3 then 100 else n
+		usef = f 0
+	`); err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"g", "f"} {
+		sym, err := r.Summarize(name)
+		fmt.Printf("%s :: %s (%v)\n", name, sym, err)
+	}
+
+	// Neither summary holds at 0, so neither is used there.
+	_, err := r.Funcs["useg"].Type(nil, nil)
+	fmt.Printf("useg raises %s\n", err)
+	typ, _ := r.Funcs["usef"].Type(nil, nil)
+	fmt.Printf("usef :: %s = %s\n", typ, r.Funcs["usef"].Eval(nil))
+	// Output:
+	// g :: x (<nil>)
+	// f :: x (<nil>)
+	// useg raises 2:23: cannot take head of an empty list: [0]any, in g(0)
+	// usef :: 100 = 100
+}
+
+func ExampleRuntime_Summarize_recursive() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		h n = if n < 1 then head [] else if n < 4 then h(n - 1) + 1 else n
+		use = h 3
+	`); err != nil {
+		panic(err)
+	}
+	sym, err := r.Summarize("h")
+	fmt.Printf("h :: %s (%v)\n", sym, err)
+
+	// The summary was only checked from 4 up, so the calls below are analysed
+	// as they are.
+	_, err = r.Funcs["use"].Type(nil, nil)
+	fmt.Printf("use raises %s\n", err)
+	typ, _ := r.Funcs["h"].Type(nil, []Type{InRange(4, 100)})
+	fmt.Printf("h :: [4, 100] -> %s\n", typ)
+	// Output:
+	// h :: x (<nil>)
+	// use raises 2:23: cannot take head of an empty list: [0]any, in h(0) <- h(1) <- h(2) <- h(3)
+	// h :: [4, 100] -> int[4, 100]
+}
+
+func ExampleRuntime_Preconditions() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		head1 x = head x
+		ratio a, b = a / b
+		first (x:xs) = x
+		second xs = first (tail xs)
+		pick n, xs = if n > 0 then head xs else 0
+		safe [] = 0
+		safe (x:xs) = x
+		never x = head []
+	`); err != nil {
+		panic(err)
+	}
+	// pick 0 [] is safe too: only one path needs xs to be non-empty, but
+	// each argument is constrained on its own, so the precondition given is
+	// only Sufficient.
+	for _, pre := range r.Preconditions() {
+		fmt.Println(pre)
+	}
+	// Output:
+	// first requires argument 1 :: [1, ∞)any
+	// head1 requires x :: [1, ∞)any
+	// never may always fail: 9:18: needed [1, ∞)any, but [] is [0]any
+	// pick is safe if xs :: [1, ∞)any
+	// ratio requires b :: int[1, ∞)
+	// safe requires nothing
+	// second requires xs :: [2, ∞)any
+}
+
+func ExampleCounterexample() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		first (x:xs) = x
+		scale n = 100 / (n - 3)
+		spurious n = 100 / (n * n + 1)
+	`); err != nil {
+		panic(err)
+	}
+
+	_, err := r.Analyse("first", []Type{{Range: InRange(0, 3).Range, Elem: &Type{Range: UNDEF}}})
+	fmt.Println(err)
+	_, err = r.Analyse("scale", []Type{InRange(0, 10)})
+	fmt.Println(err)
+	_, err = r.Analyse("spurious", []Type{InRange(-10, 10)})
+	_, real := err.(*Counterexample)
+	fmt.Println(real)
+	// Output:
+	// 2:3: undefined, in first([0, 3]any) (e.g. first([]) fails: failure to pattern match)
+	// 3:13: divisor may be zero: int[-3, 7], in (100 / (x - 3)), in scale(int[0, 10]) (e.g. scale(3) fails: integer divide by zero)
+	// false
+}
+
+func ExampleRangeSet() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		sign n = if n == 0 then 0 else n / abs n
+		abs n = if n < 0 then -n else n
+
+		inverse x = if x != 0 then 100 / x else 0
+		mod x = if x != 0 then 100 % x else 0
+
+		pred n = if n == 3 then 30 else if n == 1 then 10 else n
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, err := r.Funcs["sign"].Type(nil, []Type{InRange(-5, 5)})
+	fmt.Printf("sign :: [-5, 5] -> %s (%v)\n", typ, err)
+
+	// A divisor can be either side of zero, as long as it can't be zero.
+	typ, err = r.Funcs["inverse"].Type(nil, []Type{InRange(-10, 10)})
+	fmt.Printf("inverse :: [-10, 10] -> %s (%v)\n", typ, err)
+	typ, err = r.Funcs["mod"].Type(nil, []Type{InRange(-10, 10)})
+	fmt.Printf("mod :: [-10, 10] -> %s (%v)\n", typ, err)
+
+	typ, _ = r.Funcs["pred"].Type(nil, []Type{InRange(0, 4)})
+	fmt.Printf("pred :: [0, 4] -> %s\n", typ)
+	fmt.Printf("pred 1 = %s\n", r.Funcs["pred"].Eval([]Obj{{Int: 1}}))
+	// Output:
+	// sign :: [-5, 5] -> int[-5, 5] (<nil>)
+	// inverse :: [-10, 10] -> int[-100, -10] ∪ [0] ∪ [10, 100] (<nil>)
+	// mod :: [-10, 10] -> int[0, 9] (<nil>)
+	// pred :: [0, 4] -> int[0] ∪ [2] ∪ [4] ∪ [10] ∪ [30]
+	// pred 1 = 10
+}
+
+func ExampleCongruence() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		offset n = 4 * n + 8
+		aligned n = offset n % 4
+		pairs x = if x % 2 == 0 then x else x + 1
+	`); err != nil {
+		panic(err)
+	}
+
+	for _, name := range []string{"offset", "aligned", "pairs"} {
+		typ, _ := r.Funcs[name].Type(nil, []Type{InRange(0, 50)})
+		fmt.Printf("%s :: [0, 50] -> %s\n", name, typ)
+	}
+	// Output:
+	// offset :: [0, 50] -> int[8, 208] ≡ 0 (mod 4)
+	// aligned :: [0, 50] -> 0
+	// pairs :: [0, 50] -> int[0, 50] ≡ 0 (mod 2)
+}
+
+func ExampleCompare_relational() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		gap x, y = if x == y then 10 / (x - y + 1) else 0
+		spread x, y = if x < y then y - x else x - y
+		order x, y = if x <= y then (if y < x then 1 / 0 else 1) else 2
+		use a = spread(a, a)
+	`); err != nil {
+		panic(err)
+	}
+	typ, _ := r.Funcs["use"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("use :: [0, 10] -> %s\n", typ)
+
+	r.Relational = true
+	typ, _ = r.Funcs["use"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("use :: [0, 10] -> %s\n", typ)
+
+	args := []Type{InRange(0, 10), InRange(0, 10)}
+	for _, name := range []string{"gap", "spread", "order"} {
+		typ, err := r.Funcs[name].Type(nil, args)
+		fmt.Printf("%s :: [0, 10], [0, 10] -> %s (%v)\n", name, typ, err)
+	}
+	// Output:
+	// use :: [0, 10] -> int[-10, 10]
+	// use :: [0, 10] -> int[0, 10]
+	// gap :: [0, 10], [0, 10] -> int[0] ∪ [10] ≡ 0 (mod 10) (<nil>)
+	// spread :: [0, 10], [0, 10] -> int[0, 10] (<nil>)
+	// order :: [0, 10], [0, 10] -> int[1, 2] (<nil>)
+}
+
+func ExampleHead() {
+	r := &Runtime{Prefixes: true}
+	if err := r.ParseFile(`
+		repeat 0 = []
+		repeat n = n : repeat(n - 1)
+
+		five = head(repeat 5)
+		one = head(1 : 2 : [])
+		four = head(tail(repeat 5))
+		pair = tail(1 : 2 : [])
+		positive xs = if head xs > 0 then 10 / head xs else 0
+	`); err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"five", "one", "four", "pair"} {
+		typ, _ := r.Funcs[name].Type(nil, nil)
+		fmt.Printf("%s :: %s\n", name, typ)
+	}
+
+	list := Type{Range: Range{1, 3}, Elem: &Type{Range: Range{-5, 5}}}
+	typ, err := r.Funcs["positive"].Type(nil, []Type{list})
+	fmt.Printf("positive :: %s -> %s (%v)\n", list, typ, err)
+	// Output:
+	// five :: 5
+	// one :: 1
+	// four :: 4
+	// pair :: [1]2
+	// positive :: [1, 3]int[-5, 5] -> int[0] ∪ [2, 10] (<nil>)
+}
+
+func ExampleTail() {
+	r := &Runtime{Prefixes: true}
+	if err := r.ParseFile(`
+		repeat 0 = []
+		repeat n = n : repeat(n - 1)
+
+		rest n = tail(repeat n)
+		chain x = tail(tail(x : (x + 1) : (x + 2) : []))
+		swap (a:b:xs) = b : a : xs
+	`); err != nil {
+		panic(err)
+	}
+	typ, err := r.Funcs["rest"].Type(nil, []Type{InRange(3, 5)})
+	fmt.Printf("rest :: [3, 5] -> %s (%v)\n", typ, err)
+
+	typ, err = r.Funcs["chain"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("chain :: [0, 10] -> %s (%v)\n", typ, err)
+
+	list := Type{Range: Range{2, 4}, Elem: &Type{Range: Range{0, 9}}}
+	typ, err = r.Funcs["swap"].Type(nil, []Type{list})
+	fmt.Printf("swap :: %s -> %s (%v)\n", list, typ, err)
+	// Output:
+	// rest :: [3, 5] -> [2, 4]{int[2, 4], int[1, 3], int[1, 2]}int[1, 5] (<nil>)
+	// chain :: [0, 10] -> [1]int[2, 12] (<nil>)
+	// swap :: [2, 4]int[0, 9] -> [2, 4]int[0, 9] (<nil>)
 }
@@ -4,6 +4,10 @@ import (
 	"fmt"
 )
 
+// What Eval panics with when the program being run fails, as opposed to the
+// interpreter.
+type Failure string
+
 type Obj struct {
 	Int  int64
 	Vals []Obj
@@ -12,6 +16,8 @@ type Obj struct {
 func (o Obj) String() string {
 	if o.Vals == nil {
 		return fmt.Sprintf("%d", o.Int)
+	} else if len(o.Vals) == 0 {
+		return "[]"
 	} else {
 		buf := ""
 		for _, elem := range o.Vals {
@@ -40,6 +46,53 @@ func (p *Plus) Eval(args []Obj) Obj {
 	return Obj{Int: p.A.Eval(args).Int + p.B.Eval(args).Int}
 }
 
+// Evaluate the product of the two arguments.
+func (t *Times) Eval(args []Obj) Obj {
+	return Obj{Int: t.A.Eval(args).Int * t.B.Eval(args).Int}
+}
+
+// Evaluate the quotient of the two arguments.
+func (d *Divide) Eval(args []Obj) Obj {
+	a, b := d.A.Eval(args).Int, d.B.Eval(args).Int
+	if b == 0 {
+		panic(Failure("integer divide by zero"))
+	}
+	return Obj{Int: a / b}
+}
+
+// Evaluate the remainder of the two arguments.
+func (m *Modulo) Eval(args []Obj) Obj {
+	a, b := m.A.Eval(args).Int, m.B.Eval(args).Int
+	if b == 0 {
+		panic(Failure("integer divide by zero"))
+	}
+	return Obj{Int: a % b}
+}
+
+// Evaluate the comparison of the two arguments.
+func (c *Compare) Eval(args []Obj) Obj {
+	a, b := c.A.Eval(args).Int, c.B.Eval(args).Int
+	var holds bool
+	switch c.Op {
+	case "<":
+		holds = a < b
+	case "<=":
+		holds = a <= b
+	case "==":
+		holds = a == b
+	case "!=":
+		holds = a != b
+	case ">=":
+		holds = a >= b
+	case ">":
+		holds = a > b
+	}
+	if holds {
+		return Obj{Int: 1}
+	}
+	return Obj{Int: 0}
+}
+
 // Evaluate this negation.
 func (n *Negate) Eval(args []Obj) Obj {
 	return Obj{Int: -n.Elem.Eval(args).Int}
@@ -61,7 +114,17 @@ func (i *If) Eval(args []Obj) Obj {
 
 // Evaluate this function call.
 func (a *Apply) Eval(args []Obj) Obj {
-	return a.Runtime.Funcs[a.Name].Eval([]Obj{a.Arg.Eval(args)})
+	if r := a.Runtime; r.maxDepth > 0 {
+		if r.depth++; r.depth > r.maxDepth {
+			panic(errTooDeep)
+		}
+		defer func() { r.depth-- }()
+	}
+	vals := make([]Obj, len(a.Args))
+	for i, arg := range a.Args {
+		vals[i] = arg.Eval(args)
+	}
+	return a.Runtime.Funcs[a.Name].Eval(vals)
 }
 
 // Evaluate this prepend call.
@@ -73,15 +136,41 @@ func (p *Prepend) Eval(args []Obj) Obj {
 
 // Evaluate the first element of the list.
 func (h *Head) Eval(args []Obj) Obj {
-	return h.List.Eval(args).Vals[0]
+	l := h.List.Eval(args)
+	if len(l.Vals) == 0 {
+		panic(Failure("head of an empty list"))
+	}
+	return l.Vals[0]
 }
 
 // Evaluate the remaining elements of the list.
 func (t *Tail) Eval(args []Obj) Obj {
-	return Obj{Vals: t.List.Eval(args).Vals[1:]}
+	l := t.List.Eval(args)
+	if len(l.Vals) == 0 {
+		panic(Failure("tail of an empty list"))
+	}
+	return Obj{Vals: l.Vals[1:]}
+}
+
+// Evaluate the number of elements in the list.
+func (l *length) Eval(args []Obj) Obj {
+	return Obj{Int: int64(len(l.List.Eval(args).Vals))}
+}
+
+// Evaluate the body with the bound variable.
+func (l *Let) Eval(args []Obj) Obj {
+	lcls := make([]Obj, l.scope(len(args)))
+	copy(lcls, args)
+	lcls[l.Index] = l.Value.Eval(args)
+	return l.Body.Eval(lcls)
+}
+
+// Evaluate the located node.
+func (l *Located) Eval(args []Obj) Obj {
+	return l.Node.Eval(args)
 }
 
 // Evaluate a pattern match failure.
 func (t *Undef) Eval(args []Obj) Obj {
-	panic("pattern match!")
+	panic(Failure(t.Message))
 }
@@ -33,3 +33,52 @@ func ExampleNode_Eval() {
 	// fib 5 = 8
 	// repeat 3 = 3 : 2 : 1 : []
 }
+
+func ExampleApply() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		pow b, 0 = 1
+		pow b, e = b * pow(b, e - 1)
+		cube x = pow(x, 3)
+	`); err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("pow 2, 10 = %s\n", r.Funcs["pow"].Eval([]Obj{{Int: 2}, {Int: 10}}))
+	fmt.Printf("cube 3 = %s\n", r.Funcs["cube"].Eval([]Obj{{Int: 3}}))
+
+	typ, _ := r.Funcs["cube"].Type(nil, []Type{InRange(-2, 3)})
+	fmt.Printf("cube :: [-2, 3] -> %s\n", typ)
+	// Output:
+	// pow 2, 10 = 1024
+	// cube 3 = 27
+	// cube :: [-2, 3] -> int[-18, 27]
+}
+
+func Example_listPatterns() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		sum [] = 0
+		sum (x : xs) = x + sum xs
+
+		first (x : xs) = x
+		second (x : y : rest) = y
+	`); err != nil {
+		panic(err)
+	}
+
+	list := Obj{Vals: []Obj{{Int: 4}, {Int: 5}, {Int: 6}}}
+	fmt.Printf("sum %s = %s\n", list, r.Funcs["sum"].Eval([]Obj{list}))
+	fmt.Printf("second %s = %s\n", list, r.Funcs["second"].Eval([]Obj{list}))
+
+	// Matching x : xs proves that the list isn't empty.
+	typ, _ := r.Funcs["first"].Type(nil, []Type{{Range: Range{1, 5}, Elem: &Type{Range: Range{1, 3}}}})
+	fmt.Printf("first :: [1, 5]int[1, 3] -> %s\n", typ)
+	_, err := r.Funcs["first"].Type(nil, []Type{{Range: Range{0, 5}, Elem: &Type{Range: Range{1, 3}}}})
+	fmt.Printf("first :: [0, 5]int[1, 3] raises %s\n", err)
+	// Output:
+	// sum 4 : 5 : 6 : [] = 15
+	// second 4 : 5 : 6 : [] = 5
+	// first :: [1, 5]int[1, 3] -> int[1, 3]
+	// first :: [0, 5]int[1, 3] raises 5:3: undefined
+}
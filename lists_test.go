@@ -0,0 +1,63 @@
+package madison
+
+import (
+	"testing"
+)
+
+var listRestrictions = []struct {
+	Node   Node
+	Locals []string
+	To     string
+	Exp    []string // nil if the restriction is impossible
+}{
+	{&Tail{&Var{0}}, []string{"[0, 10]int[0, 9]"}, "[2, 3]int[0, 4]",
+		[]string{"[3, 4]{int[0, 9], int[0, 4], int[0, 4], int[0, 4]}int[0, 9]"}},
+	{&Tail{&Var{0}}, []string{"[0, 1]int[0, 9]"}, "[1, 5]any", nil},
+	{&Tail{&Var{0}}, []string{"[0, 10]any"}, "int[0, 5]", nil},
+	{&Tail{&Tail{&Var{0}}}, []string{"[0, 10]int[0, 9]"}, "[0]any",
+		[]string{"[2]int[0, 9]"}},
+	{&Prepend{&Var{0}, &Var{1}}, []string{"int[-5, 5]", "[0, 10]int[-5, 5]"},
+		"[2, 3]{int[1, 2]}int[0, 9]",
+		[]string{"int[1, 2]", "[1, 2]int[0, 5]"}},
+	{&Prepend{&Var{0}, &Var{1}}, []string{"int[-5, 5]", "[0, 10]int[-5, 5]"},
+		"[0]any", nil},
+	{&Prepend{&Var{0}, &Var{1}}, []string{"int[-5, 5]", "[0, 10]int[-5, 5]"},
+		"int[1, 3]", nil},
+	{&Prepend{Const(1), &Prepend{&Var{0}, &Tail{&Var{1}}}},
+		[]string{"int[-5, 5]", "[0, 10]int[-5, 5]"}, "[3]{1, 2, int[0, 1]}int[0, 2]",
+		[]string{"2", "[2]{int[-5, 5], int[0, 1]}int[-5, 5]"}},
+}
+
+func TestListRestrictTo(t *testing.T) {
+	parse := func(text string) Type {
+		typ, err := ParseType(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+	cs := []CallSite{{runtime: &Runtime{Prefixes: true}}}
+	for i, c := range listRestrictions {
+		locals := make([]Type, len(c.Locals))
+		for j, text := range c.Locals {
+			locals[j] = parse(text)
+		}
+		err := c.Node.RestrictTo(cs, locals, parse(c.To))
+		if c.Exp == nil {
+			if err == nil {
+				t.Errorf("%d: %s :: %s gave %s (expecting an error)", i, c.Node, c.To,
+					typesString(locals))
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d: %s :: %s failed: %s", i, c.Node, c.To, err)
+			continue
+		}
+		for j, exp := range c.Exp {
+			if got := locals[j].String(); got != exp {
+				t.Errorf("%d: %s :: %s gave %s %s (expecting %s)", i, c.Node, c.To,
+					&Var{j}, got, exp)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package madison
+
+import (
+	"math"
+)
+
+// Bounds on the sum and difference of one local with another.
+type relation struct {
+	Sum, Diff Range
+}
+
+// The relations of one local to the others, by index. Never modified once
+// made, so copies of locals can share it.
+type relations map[int]relation
+
+// Describes a node computing Sign * locals[Index] + Offset.
+type linear struct {
+	Index, Sign, Offset int
+}
+
+// Finds the local that n is a linear function of, if there is one.
+func linearOf(n Node) (linear, bool) {
+	switch n := unlocated(n).(type) {
+	case *Var:
+		return linear{n.index, 1, 0}, true
+	case *Negate:
+		l, ok := linearOf(n.Elem)
+		return linear{l.Index, -l.Sign, -l.Offset}, ok
+	case *Plus:
+		if l, ok := linearOf(n.A); ok {
+			if c, ok := constantOf(n.B); ok {
+				return linear{l.Index, l.Sign, l.Offset + c}, true
+			}
+		} else if l, ok := linearOf(n.B); ok {
+			if c, ok := constantOf(n.A); ok {
+				return linear{l.Index, l.Sign, l.Offset + c}, true
+			}
+		}
+	}
+	return linear{}, false
+}
+
+// Finds the value of n, if it is a (possibly negated) constant.
+func constantOf(n Node) (int, bool) {
+	switch n := unlocated(n).(type) {
+	case Const:
+		return int(n), true
+	case *Negate:
+		c, ok := constantOf(n.Elem)
+		return -c, ok
+	}
+	return 0, false
+}
+
+// Returns -n, for the linear n.
+func (n linear) negated() linear {
+	return linear{n.Index, -n.Sign, -n.Offset}
+}
+
+// Returns what is known about locals[i] + locals[j] and locals[i] -
+// locals[j], from their relation and their ranges.
+func related(locals []Type, i, j int) relation {
+	a, b := locals[i].Range, locals[j].Range
+	r := relation{conv(a, b), conv(a, inverse(b))}
+	if known, ok := locals[i].rel[j]; ok {
+		r.Sum, _ = meet(r.Sum, known.Sum)
+		r.Diff, _ = meet(r.Diff, known.Diff)
+	}
+	return r
+}
+
+// Intersects a with each of bs, returning false (and a) if nothing is left.
+func meet(a Range, bs ...Range) (Range, bool) {
+	for _, b := range bs {
+		c := intersect(a, b)
+		if len(c) == 0 {
+			return a, false
+		}
+		a = c[0]
+	}
+	return a, true
+}
+
+// Narrows locals[i] to r, returning false if nothing is left.
+func narrow(locals []Type, i int, r Range) bool {
+	if r == locals[i].Range {
+		return true
+	}
+	s := locals[i].ranges().intersect(RangeSet{r})
+	if len(s) == 0 {
+		return false
+	}
+	locals[i] = locals[i].withRanges(s)
+	return true
+}
+
+// Computes the range of a + b, if they are linear in locals and what is
+// known about them relates them.
+func combine(locals []Type, a, b linear) (Range, bool) {
+	offset := Range{a.Offset + b.Offset, a.Offset + b.Offset}
+	if a.Index == b.Index {
+		if a.Sign+b.Sign != 0 {
+			return UNDEF, false
+		}
+		return offset, true // x - x
+	}
+	r := related(locals, a.Index, b.Index)
+	switch {
+	case a.Sign > 0 && b.Sign > 0:
+		return conv(r.Sum, offset), true
+	case a.Sign > 0:
+		return conv(r.Diff, offset), true
+	case b.Sign > 0:
+		return conv(inverse(r.Diff), offset), true
+	}
+	return conv(inverse(r.Sum), offset), true
+}
+
+// Narrows locals so that a + b lies in t, if they are linear in different
+// locals, returning false if they can't.
+func constrain(locals []Type, a, b linear, t Range) bool {
+	if a.Index == b.Index {
+		return true
+	}
+	t = conv(t, Range{-a.Offset - b.Offset, -a.Offset - b.Offset})
+	if a.Sign < 0 {
+		a, b, t = linear{a.Index, 1, 0}, linear{b.Index, -b.Sign, 0}, inverse(t)
+	}
+	r := related(locals, a.Index, b.Index)
+	if b.Sign > 0 {
+		return relate(locals, a.Index, b.Index, intersect(r.Sum, t), []Range{r.Diff})
+	}
+	return relate(locals, a.Index, b.Index, []Range{r.Sum}, intersect(r.Diff, t))
+}
+
+// Records that locals[i] + locals[j] and locals[i] - locals[j] lie in the
+// given ranges (if any), narrowing both locals to match. Returns false if
+// there are no such values.
+func relate(locals []Type, i, j int, sum, diff []Range) bool {
+	if len(sum) == 0 || len(diff) == 0 {
+		return false
+	}
+	r := relation{sum[0], diff[0]}
+	if r.Sum == UNDEF && r.Diff == UNDEF {
+		return true
+	}
+
+	// x is in y + (x - y) and (x + y) - y, and similarly for y.
+	x, y := locals[i].Range, locals[j].Range
+	x, xok := meet(x, conv(y, r.Diff), conv(r.Sum, inverse(y)))
+	y, yok := meet(y, conv(x, inverse(r.Diff)), conv(r.Sum, inverse(x)))
+	if !xok || !yok || !narrow(locals, i, x) || !narrow(locals, j, y) {
+		return false
+	}
+
+	locals[i].rel = locals[i].rel.with(j, r)
+	locals[j].rel = locals[j].rel.with(i, relation{r.Sum, inverse(r.Diff)})
+	return true
+}
+
+// Narrows what other locals are related to, now that locals[i] lies in its
+// (possibly narrower) range.
+func propagate(locals []Type, i int) bool {
+	x := locals[i].Range
+	for j, r := range locals[i].rel {
+		if j >= len(locals) {
+			continue
+		}
+		y, ok := meet(locals[j].Range, conv(x, inverse(r.Diff)),
+			conv(r.Sum, inverse(x)))
+		if !ok || !narrow(locals, j, y) {
+			return false
+		}
+	}
+	return true
+}
+
+// Forgets every relation to locals[i] (e.g. because it is being rebound).
+func unrelate(locals []Type, i int) {
+	for j := range locals {
+		if _, ok := locals[j].rel[i]; ok {
+			locals[j].rel = locals[j].rel.without(i)
+		}
+	}
+	if i < len(locals) {
+		locals[i].rel = nil
+	}
+}
+
+// Returns a copy of rs with the relation to j set to r.
+func (rs relations) with(j int, r relation) relations {
+	out := relations{j: r}
+	for k, v := range rs {
+		if k != j {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Returns a copy of rs without any relation to j.
+func (rs relations) without(j int) relations {
+	out := relations{}
+	for k, v := range rs {
+		if k != j {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Computes the range of A - B, if they are both linear in locals.
+func (c *Compare) difference(locals []Type) (RangeSet, bool) {
+	la, ok := linearOf(c.A)
+	if !ok {
+		return nil, false
+	}
+	lb, ok := linearOf(c.B)
+	if !ok {
+		return nil, false
+	}
+	d, ok := combine(locals, la, lb.negated())
+	return RangeSet{d}, ok
+}
+
+// Computes the differences d such that "x op y" holds whenever x - y = d.
+func differences(op string) Range {
+	switch op {
+	case "<":
+		return Range{math.MinInt32, -1}
+	case "<=":
+		return Range{math.MinInt32, 0}
+	case ">":
+		return Range{1, math.MaxInt32}
+	case ">=":
+		return Range{0, math.MaxInt32}
+	case "==":
+		return Range{0, 0}
+	}
+	return UNDEF
+}
@@ -2,6 +2,7 @@ package madison
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"unicode"
@@ -18,81 +19,152 @@ var parser = mast.Parser{
 	},
 	Operators: []mast.Prec{
 		{[]string{","}, mast.InfixRight},
+		{[]string{"<", "<=", "==", "!=", ">=", ">"}, mast.InfixLeft},
 		{[]string{":"}, mast.InfixRight},
 		{[]string{"+", "-"}, mast.InfixLeft},
-		{[]string{"*"}, mast.InfixLeft},
+		{[]string{"*", "/", "%"}, mast.InfixLeft},
 	},
 	AdjacentIsApplication: true,
 }
 
-// b 0 = 2 => b = (case @0 of 2 => | a => nil)
-func (r *Runtime) mastToTuple(e mast.Expr, lv bool, as *[]string) (a []Node) {
+// Splits a, b, c into its elements.
+func tuple(e mast.Expr) (a []mast.Expr) {
 	for {
 		t, ok := e.(*mast.Binary)
 		if ok && t.Op == "," {
-			a = append(a, r.mastToExpr(t.Left, lv, as))
+			a = append(a, t.Left)
 			e = t.Right
 		} else {
 			break
 		}
 	}
-	return append(a, r.mastToExpr(e, lv, as))
+	return append(a, e)
+}
+
+// The builtin functions, and how many arguments each takes.
+var builtins = map[string]int{
+	"ifz": 3, "if": 3, "let": 3, "head": 1, "tail": 1,
+}
+
+// Converts a single parsed equation into Nodes.
+type converter struct {
+	*Runtime
+
+	// Where each parsed expression came from.
+	spans map[mast.Expr]Span
+
+	// The whole equation being converted.
+	line Span
+}
+
+// Stops converting, reporting a problem with e. This panics with a
+// *ParseError, which Runtime.parse recovers.
+func (c *converter) fail(kind ParseErrorKind, e mast.Expr, format string,
+	args ...interface{}) {
+
+	span, ok := c.spans[e]
+	if !ok {
+		span = c.line
+	}
+	panic(&ParseError{kind, fmt.Sprintf(format, args...), span})
+}
+
+// b 0 = 2 => b = (case @0 of 2 => | a => nil)
+func (c *converter) mastToTuple(e mast.Expr, lv bool, as *[]string) (a []Node) {
+	for _, elem := range tuple(e) {
+		a = append(a, c.mastToExpr(elem, lv, as))
+	}
+	return
+}
+
+// let(x, v, body) => Let{@n, v, body}, where x is @n in body
+func (c *converter) mastToLet(e mast.Expr, lval bool, args *[]string) Node {
+	operands := tuple(e)
+	name, ok := operands[0].(*mast.Var)
+	if !ok || !isName(name.Name) {
+		c.fail(SyntaxError, operands[0], "cannot bind %v", operands[0])
+	}
+	value := c.mastToExpr(operands[1], lval, args)
+	*args = append(*args, name.Name)
+	index := len(*args) - 1
+	body := c.mastToExpr(operands[2], lval, args)
+	(*args)[index] = "" // out of scope
+	return &Let{index, value, body}
+}
+
+// Converts e into a Node, remembering where it came from (unless it is a
+// pattern).
+func (c *converter) mastToExpr(e mast.Expr, lval bool, args *[]string) Node {
+	n := c.convert(e, lval, args)
+	if span, ok := c.spans[e]; ok && !lval {
+		return &Located{span, n, c.Runtime}
+	}
+	return n
 }
 
-func (r *Runtime) mastToExpr(e mast.Expr, lval bool, args *[]string) Node {
+func (c *converter) convert(e mast.Expr, lval bool, args *[]string) Node {
 	switch e := e.(type) {
 	case *mast.Unary: // only -
-		x := r.mastToExpr(e.Elem, lval, args)
+		x := c.mastToExpr(e.Elem, lval, args)
 		return &Negate{x}
 	case *mast.Binary:
-		if e.Op == ":" { // prepend / cons
-			head := r.mastToExpr(e.Left, lval, args)
-			tail := r.mastToExpr(e.Right, lval, args)
-			return &Prepend{head, tail}
-		} else { // + or -
-			a := r.mastToExpr(e.Left, lval, args)
-			b := r.mastToExpr(e.Right, lval, args)
-			if e.Op == "-" {
-				b = &Negate{b}
-			}
+		a := c.mastToExpr(e.Left, lval, args)
+		b := c.mastToExpr(e.Right, lval, args)
+		switch e.Op {
+		case ":": // prepend / cons
+			return &Prepend{a, b}
+		case "*":
+			return &Times{a, b}
+		case "/":
+			return &Divide{a, b}
+		case "%":
+			return &Modulo{a, b}
+		case "-":
+			return &Plus{a, &Negate{b}}
+		case "+":
 			return &Plus{a, b}
+		default: // < <= == != >= >
+			return &Compare{e.Op, a, b}
 		}
 	case *mast.Apply:
-		m := e.Operator.(*mast.Var)
-		args := r.mastToTuple(e.Operand, lval, args)
+		m, ok := e.Operator.(*mast.Var)
+		if !ok || !isName(m.Name) {
+			c.fail(SyntaxError, e.Operator, "cannot call %v", e.Operator)
+		}
+		if n, ok := builtins[m.Name]; ok && len(tuple(e.Operand)) != n {
+			c.fail(ArityError, e, "%s takes %d arguments, got %d",
+				m.Name, n, len(tuple(e.Operand)))
+		}
+		if m.Name == "let" { // let name = value in body
+			return c.mastToLet(e.Operand, lval, args)
+		}
+		args := c.mastToTuple(e.Operand, lval, args)
 		switch m.Name {
 		case "ifz":
-			if len(args) != 3 {
-				panic(fmt.Sprintf("ifz takes three arguments, got %#v", args))
-			}
 			cond, zero, nonzero := args[0], args[1], args[2]
 			return &If{cond, zero, nonzero}
+		case "if": // if cond then a else b
+			cond, then, els := args[0], args[1], args[2]
+			return &If{cond, els, then}
 		case "head":
-			if len(args) != 1 {
-				panic(fmt.Sprintf("head takes one arguments, got %#v", args))
-			}
 			return &Head{args[0]}
 		case "tail":
-			if len(args) != 1 {
-				panic(fmt.Sprintf("tail takes one arguments, got %#v", args))
-			}
 			return &Tail{args[0]}
 		default:
-			if len(args) != 1 {
-				panic(fmt.Sprintf(
-					"user-defined function %s can only accept 1 arg, not %#v", args))
-			}
-			return &Apply{r, m.Name, args[0]}
+			return &Apply{c.Runtime, m.Name, args}
 		}
 	case *mast.Var:
 		if unicode.IsDigit(rune(e.Name[0])) {
-			v, _ := strconv.ParseInt(e.Name, 10, 64)
+			v, err := strconv.ParseInt(e.Name, 10, 64)
+			if err != nil || v >= math.MaxInt32 {
+				c.fail(LiteralError, e, "invalid integer %s", e.Name)
+			}
 			return Const(v)
 		} else if e.Name == "[]" {
 			return EmptyList{}
 		} else {
-			for i, arg := range *args {
-				if arg == e.Name {
+			for i := len(*args) - 1; i >= 0; i-- {
+				if (*args)[i] == e.Name {
 					return &Var{i}
 				}
 			}
@@ -100,66 +172,314 @@ func (r *Runtime) mastToExpr(e mast.Expr, lval bool, args *[]string) Node {
 				*args = append(*args, e.Name)
 				return &Var{len(*args) - 1}
 			} else {
-				return &Apply{r, e.Name, Const(0)}
+				return &Apply{c.Runtime, e.Name, nil}
 			}
 		}
 	default:
-		panic(fmt.Sprintf("not sure what to do with %v", e))
+		c.fail(SyntaxError, e, "not sure what to do with %v", e)
+	}
+	return nil
+}
+
+// Returns true if the given identifier names a variable or function (rather
+// than a literal).
+func isName(ident string) bool {
+	return ident != "" && ident != "[]" && !unicode.IsDigit(rune(ident[0]))
+}
+
+// Finds where e (and each of its parts) appears in src after cursor,
+// returning where it starts and ends.
+func (c *converter) locate(e mast.Expr, src source, file string,
+	cursor *int) (start, end int, ok bool) {
+
+	find := func(token string) int {
+		i := strings.Index(src.text[*cursor:], token)
+		if i < 0 {
+			return -1
+		}
+		*cursor += i + len(token)
+		return *cursor - len(token)
+	}
+
+	switch e := e.(type) {
+	case *mast.Var:
+		start = find(e.Name)
+		end, ok = start+len(e.Name), start >= 0
+	case *mast.Unary: // only -
+		start = find("-")
+		_, end, ok = c.locate(e.Elem, src, file, cursor)
+		ok = ok && start >= 0
+	case *mast.Binary:
+		var rok bool
+		start, _, ok = c.locate(e.Left, src, file, cursor)
+		find(e.Op)
+		_, end, rok = c.locate(e.Right, src, file, cursor)
+		ok = ok && rok
+	case *mast.Apply:
+		var rok bool
+		start, _, ok = c.locate(e.Operator, src, file, cursor)
+		_, end, rok = c.locate(e.Operand, src, file, cursor)
+		ok = ok && rok
 	}
+
+	if ok {
+		last := src.at(end - 1)
+		c.spans[e] = Span{file, src.at(start), Pos{last.Line, last.Col + 1}}
+	}
+	return
 }
 
+// Parses a single equation, adding it to the runtime.
 func (r *Runtime) Parse(text string) error {
+	_, err := r.parse(newSource(text, 1), "")
+	return err
+}
+
+// Parses a single equation from the given file, returning the name of the
+// function it defines (if any). Any error is a *ParseError.
+func (r *Runtime) parse(src source, file string) (defined string, err error) {
 	if r.Funcs == nil {
 		r.Funcs = map[string]Node{}
 	}
-	tree, err := parser.Parse(text)
+	if r.arity == nil {
+		r.arity = map[string]int{}
+	}
+	if r.params == nil {
+		r.params = map[string][]string{}
+	}
+	line := Span{file, src.at(0), src.at(len(src.text))}
+	c := &converter{r, map[mast.Expr]Span{}, line}
+	defer catch(&err)
+
+	if at := strings.Index(src.text, "::"); at >= 0 {
+		c.signature(src, at)
+		return "", nil
+	}
+
+	src = desugar(src)
+	tree, err := parser.Parse(src.text)
 	if err != nil {
-		return err
+		return "", &ParseError{SyntaxError, err.Error(), line}
+	}
+	c.locate(tree, src, file, new(int))
+
+	// f x, y parses as (f x), y
+	lhs := tree.Left
+	if t, ok := lhs.(*mast.Binary); ok && t.Op == "," {
+		if app, ok := t.Left.(*mast.Apply); ok {
+			lhs = &mast.Apply{Operator: app.Operator,
+				Operand: &mast.Binary{Op: ",", Left: app.Operand, Right: t.Right}}
+		}
 	}
 
 	names := []string{}
+	params := []string{}
 	args := []Node{}
 	name := ""
-	switch lhs := tree.Left.(type) {
+	switch lhs := lhs.(type) {
 	case *mast.Apply:
-		name = lhs.Operator.(*mast.Var).Name
-		args = r.mastToTuple(lhs.Operand, true, &names)
+		if v, ok := lhs.Operator.(*mast.Var); ok {
+			name = v.Name
+		}
+
+		// Give each argument its own local, even if it is a pattern.
+		operands := tuple(lhs.Operand)
+		names = make([]string, len(operands))
+		for i, operand := range operands {
+			if v, ok := operand.(*mast.Var); ok && isName(v.Name) {
+				names[i] = v.Name
+			}
+		}
+		params = append(params, names...)
+		for _, operand := range operands {
+			arg := c.mastToExpr(operand, true, &names)
+			if !isPattern(arg) {
+				c.fail(PatternError, operand,
+					"patterns may only contain variables, integers, [] and :")
+			}
+			args = append(args, arg)
+		}
 	case *mast.Var:
 		name = lhs.Name
-	default:
-		return fmt.Errorf("not sure what to do with %s", lhs)
+	}
+	if !isName(name) {
+		c.fail(SyntaxError, tree.Left, "cannot define %v", tree.Left)
+	}
+
+	if _, ok := builtins[name]; ok {
+		c.fail(SyntaxError, tree.Left, "cannot redefine builtin %s", name)
+	}
+	if n, ok := r.arity[name]; ok && n != len(args) {
+		c.fail(ArityError, tree.Left, "%s was already defined with %d arguments",
+			name, n)
 	}
 
 	previous, ok := r.Funcs[name]
 	if !ok {
 		previous = &Undef{"failure to pattern match"}
+		if span, ok := c.spans[tree.Left]; ok {
+			previous = &Located{span, previous, r}
+		}
 	}
 
-	rhs := r.mastToExpr(tree.Right, false, &names)
+	rhs := c.mastToExpr(tree.Right, false, &names)
 	for i, arg := range args {
-		if _, ok := arg.(*Var); !ok {
-			rhs = &If{&Plus{&Var{i}, &Negate{arg}}, rhs, previous}
-		}
+		rhs = matchPattern(arg, &Var{i}, rhs, previous)
 	}
 
 	r.Funcs[name] = rhs
-	return nil
+	r.arity[name] = len(args)
+
+	// ParseFile works upwards, so this keeps the first name in the file.
+	for i, prev := range r.params[name] {
+		if params[i] == "" {
+			params[i] = prev
+		}
+	}
+	r.params[name] = params
+	r.forget()
+	return name, nil
 }
 
-func (r *Runtime) ParseFile(text string) error {
-	lines := strings.Split(text, "\n")
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := lines[i]
-		if idx := strings.Index(line, "--"); idx >= 0 {
-			line = line[:idx]
-		}
-		line = strings.TrimSpace(line)
-		if line == "" {
+// Recovers a *ParseError raised by converter.fail into err.
+func catch(err *error) {
+	r := recover()
+	if perr, ok := r.(*ParseError); ok {
+		*err = perr
+	} else if r != nil {
+		panic(r)
+	}
+}
+
+// Returns true if n can appear on the left-hand side of a definition.
+func isPattern(n Node) bool {
+	switch n := n.(type) {
+	case *Var, Const, EmptyList:
+		return true
+	case *Negate:
+		_, ok := n.Elem.(Const)
+		return ok
+	case *Prepend:
+		return isPattern(n.Head) && isPattern(n.Tail)
+	}
+	return false
+}
+
+// Checks whether subject matches pattern, computing matched (with the
+// variables in pattern bound) if so, and failed if not.
+func matchPattern(pattern, subject, matched, failed Node) Node {
+	switch p := pattern.(type) {
+	case *Var:
+		if v, ok := subject.(*Var); ok && v.index == p.index {
+			return matched
+		}
+		return &Let{p.index, subject, matched}
+	case EmptyList:
+		return &If{&length{subject}, matched, failed}
+	case *Prepend:
+		matched = matchPattern(p.Tail, &Tail{subject}, matched, failed)
+		matched = matchPattern(p.Head, &Head{subject}, matched, failed)
+		return &If{&length{subject}, failed, matched}
+	default: // integer literal
+		return &If{&Plus{subject, &Negate{pattern}}, matched, failed}
+	}
+}
+
+// Splits text into equations, removing comments. An equation continues onto
+// each following line that is indented further than its first line, or that
+// comes after a line ending in a backslash. Lines lined up with the first
+// binding after a where each start a new binding.
+func equations(text string) []source {
+	var eqs []source
+	indent, bindings, joinNext := 0, -1, false
+	for i, raw := range strings.Split(text, "\n") {
+		line := newSource(raw, i+1)
+		if idx := strings.Index(line.text, "--"); idx >= 0 {
+			line = line.slice(0, idx)
+		}
+		line = line.trim()
+		if line.text == "" {
 			continue
 		}
-		if err := r.Parse(line); err != nil {
-			return err
+
+		col := line.at(0).Col
+		if len(eqs) > 0 && (joinNext || col > indent) {
+			sep := " "
+			if bindings == 0 {
+				bindings = col // the first binding after a lone where
+			} else if col == bindings {
+				sep = "; "
+			}
+			eqs[len(eqs)-1] = join(eqs[len(eqs)-1], inserted(sep, line.at(0)), line)
+		} else {
+			eqs = append(eqs, line)
+			indent, bindings = col, -1
+		}
+
+		last := &eqs[len(eqs)-1]
+		if joinNext = strings.HasSuffix(last.text, "\\"); joinNext {
+			*last = last.slice(0, len(last.text)-1)
+		}
+		for j := range line.text {
+			if wordAt(line.text, j) == "where" {
+				rest := line.slice(j+len("where"), len(line.text)).trim()
+				bindings = rest.at(0).Col
+				if rest.text == "" {
+					bindings = 0
+				}
+			}
 		}
 	}
+	return eqs
+}
+
+// Parses each equation in text (see equations for how they are laid out),
+// then checks that every name used by the functions it defines is defined
+// (see Resolve).
+func (r *Runtime) ParseFile(text string) error {
+	defined, err := r.parseFile("", text)
+	errs, _ := err.(ParseErrors)
+	if err != nil && errs == nil {
+		return err
+	}
+	if err := r.resolveNames(defined); err != nil && !r.KeepGoing {
+		return err
+	} else if err != nil {
+		errs = append(errs, err.(ParseErrors)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
+
+// Parses each equation in text, which came from the named file. The names
+// it uses aren't checked, so that files may call each other's functions:
+// call Resolve once they are all parsed.
+func (r *Runtime) ParseNamedFile(file, text string) error {
+	_, err := r.parseFile(file, text)
+	return err
+}
+
+// Parses each equation in text from the named file, returning the names of
+// the functions it defines. The error is the first one found, or (with
+// KeepGoing) ParseErrors holding all of them.
+func (r *Runtime) parseFile(file, text string) ([]string, error) {
+	var defined []string
+	var errs ParseErrors
+	eqs := equations(text)
+	for i := len(eqs) - 1; i >= 0; i-- {
+		name, err := r.parse(eqs[i], file)
+		if err != nil && !r.KeepGoing {
+			return defined, err
+		} else if err != nil {
+			errs = append(ParseErrors{err.(*ParseError)}, errs...)
+		} else if name != "" {
+			defined = append(defined, name)
+		}
+	}
+	if len(errs) > 0 {
+		return defined, errs
+	}
+	return defined, nil
+}
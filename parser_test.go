@@ -0,0 +1,143 @@
+package madison_test
+
+import (
+	"fmt"
+	. "github.com/fatlotus/madison"
+)
+
+func ExampleParseError() {
+	for _, text := range []string{
+		"f x = head(x, x)",
+		"f x = 99999999999",
+		"f (x + 1) = x",
+		"3 = 4",
+		"head x = x",
+		"f :: [0, 1 -> 1",
+	} {
+		r := &Runtime{}
+		err := r.Parse(text)
+		if err, ok := err.(*ParseError); ok {
+			fmt.Printf("%s (%s)\n", err, err.Kind)
+		}
+	}
+	// Output:
+	// 1:7: arity error: head takes 1 arguments, got 2 (arity error)
+	// 1:7: literal error: invalid integer 99999999999 (literal error)
+	// 1:4: pattern error: patterns may only contain variables, integers, [] and : (pattern error)
+	// 1:1: syntax error: cannot define 3 (syntax error)
+	// 1:1: syntax error: cannot redefine builtin head (syntax error)
+	// 1:6: syntax error: invalid type "[0, 1": expected ] after 1 (syntax error)
+}
+
+func ExampleParseErrors() {
+	r := &Runtime{KeepGoing: true}
+	err := r.ParseFile(`
+		double x = x * 2
+		bad x = head(x, x)
+		half x = x / 2
+		worse x = 99999999999
+	`)
+	fmt.Printf("%s\n", err)
+
+	// The equations that parsed are still defined.
+	typ, _ := r.Funcs["half"].Type(nil, []Type{InRange(0, 10)})
+	fmt.Printf("half :: [0, 10] -> %s\n", typ)
+	// Output:
+	// 3:11: arity error: head takes 1 arguments, got 2
+	// 5:13: literal error: invalid integer 99999999999
+	// half :: [0, 10] -> int[0, 5]
+}
+
+func ExampleRuntime_ParseFile() {
+	r := &Runtime{}
+	if err := r.ParseFile(`
+		-- Long expressions can continue onto indented lines.
+		clamp lo, hi, x =
+			if x < lo then lo
+			else if x > hi then hi
+			else x
+
+		-- Or onto any line, after a backslash.
+		spread x = x * x + \
+		2 * x + 1
+
+		-- Bindings lined up under a where are separate.
+		norm x = a + b
+			where a = x * x
+			      b = a + 1
+	`); err != nil {
+		panic(err)
+	}
+
+	typ, _ := r.Funcs["clamp"].Type(nil, []Type{Constant(0), Constant(10), InRange(-5, 50)})
+	fmt.Printf("clamp :: 0, 10, [-5, 50] -> %s\n", typ)
+	fmt.Printf("spread 3 = %s\n", r.Funcs["spread"].Eval([]Obj{{Int: 3}}))
+	fmt.Printf("norm 3 = %s\n", r.Funcs["norm"].Eval([]Obj{{Int: 3}}))
+	// Output:
+	// clamp :: 0, 10, [-5, 50] -> int[0, 10]
+	// spread 3 = 16
+	// norm 3 = 19
+}
+
+func ExampleRuntime_Resolve() {
+	r := &Runtime{KeepGoing: true}
+	err := r.ParseFile(`
+		square x = x * x
+		area w, h = w * h
+		cube x = squre x * x
+		room = area 3 + size
+	`)
+	for _, err := range err.(ParseErrors) {
+		fmt.Println(err)
+	}
+	// Output:
+	// 4:12: name error: undefined name squre (did you mean square?)
+	// 5:10: arity error: area takes 2 arguments, got 1
+	// 5:19: name error: undefined name size
+}
+
+func ExampleRuntime_ParseNamedFile() {
+	r := &Runtime{}
+
+	// Each file calls functions from the other, so resolve them once both
+	// are loaded.
+	if err := r.ParseNamedFile("even.mad", `
+		even 0 = 1
+		even n = odd(n - 1)
+	`); err != nil {
+		panic(err)
+	}
+	if err := r.ParseNamedFile("odd.mad", `
+		odd 0 = 0
+		odd n = even(n - 1)
+		half n = evn n / 2
+	`); err != nil {
+		panic(err)
+	}
+	fmt.Println(r.Resolve())
+	fmt.Printf("even 4 = %s\n", r.Funcs["even"].Eval([]Obj{{Int: 4}}))
+	// Output:
+	// odd.mad:4:12: name error: undefined name evn (did you mean even?)
+	// even 4 = 1
+}
+
+func ExampleRuntime_ParseNamedFile_arity() {
+	r := &Runtime{}
+	if err := r.ParseNamedFile("ratio.mad", `
+		g x, y = x / y
+		f n = g n
+	`); err != nil {
+		panic(err)
+	}
+
+	// Until the file is resolved, the call to g is only caught by analysis.
+	_, err := r.Funcs["f"].Type(nil, []Type{InRange(1, 5)})
+	fmt.Println(err)
+	for _, pre := range r.Preconditions() {
+		fmt.Println(pre)
+	}
+	// Output:
+	// ratio.mad:3:9: g takes 2 arguments, got 1
+	// f may always fail: g takes 2 arguments, got 1
+	// g requires y :: int[1, ∞)
+}
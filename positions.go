@@ -0,0 +1,169 @@
+package madison
+
+import (
+	"math"
+)
+
+// How many leading elements of a list have their own types.
+const maxPrefix = 4
+
+// Returns the type of element i of the list t, where it has one.
+func (t Type) at(i int) Type {
+	if i < len(t.Prefix) {
+		return t.Prefix[i]
+	}
+	return *t.Elem
+}
+
+// Returns the type of the list t without its first element, which it must
+// be able to have.
+func (t Type) rest() Type {
+	lengths := t.ranges().add(RangeSet{{-1, -1}})
+	r := Type{Elem: t.Elem}.withRanges(lengths.intersect(RangeSet{{0, math.MaxInt32}}))
+	if len(t.Prefix) > 1 {
+		r.Prefix = t.Prefix[1:]
+	}
+
+	// If every remaining element has its own type, so do the elements.
+	if t.End > 1 && t.End <= len(t.Prefix) {
+		elem := t.Prefix[1]
+		for _, p := range t.Prefix[2:t.End] {
+			elem, _ = TypesUnion(elem, p)
+		}
+		r.Elem = &elem
+	}
+	return trimPrefix(r)
+}
+
+// Returns the list type t with head h prepended to it.
+func prepend(h, t Type) Type {
+	elem := h
+	if t.End > 0 {
+		elem, _ = TypesUnion(h, *t.Elem)
+	}
+	l := Type{Elem: &elem}.withRanges(t.ranges().add(RangeSet{{1, 1}}))
+	l.Prefix = append([]Type{h}, t.Prefix...)
+	for i := len(t.Prefix); i < t.End && i < maxPrefix; i++ {
+		l.Prefix = append(l.Prefix, *t.Elem)
+	}
+	return trimPrefix(l)
+}
+
+// Combines the leading elements of the lists a and b (into t) with f.
+func prefixes(t, a, b Type, f func(a, b Type) Type) Type {
+	switch {
+	case t.Elem == nil:
+		return t
+	case a.End == 0:
+		t.Prefix = b.Prefix
+	case b.End == 0:
+		t.Prefix = a.Prefix
+	default:
+		n := len(a.Prefix)
+		if len(b.Prefix) > n {
+			n = len(b.Prefix)
+		}
+		t.Prefix = make([]Type, n)
+		for i := range t.Prefix {
+			switch {
+			case a.End <= i:
+				t.Prefix[i] = b.at(i)
+			case b.End <= i:
+				t.Prefix[i] = a.at(i)
+			default:
+				t.Prefix[i] = f(a.at(i), b.at(i))
+			}
+		}
+	}
+	return trimPrefix(t)
+}
+
+// Narrows the list t to the elements (and leading elements) allowed by o,
+// shortening it if some are impossible. Returns false if nothing is left.
+func meetElems(t, o Type) (Type, bool) {
+	elem, ok := meetTypes(*t.Elem, *o.Elem)
+	if !ok {
+		return shorten(t, 0)
+	}
+	t.Elem = &elem
+
+	n := len(t.Prefix)
+	if len(o.Prefix) > n {
+		n = len(o.Prefix)
+	}
+	prefix := make([]Type, 0, n)
+	for i := 0; i < n; i++ {
+		p, ok := meetTypes(t.at(i), o.at(i))
+		if !ok {
+			t.Prefix = prefix
+			return shorten(t, i)
+		}
+		prefix = append(prefix, p)
+	}
+	t.Prefix = prefix
+	return trimPrefix(t), true
+}
+
+// Returns the values in both a and b (or some of them, as long as they are
+// all in a), and false if there are none.
+func meetTypes(a, b Type) (Type, bool) {
+	if b.isAny() {
+		return a, true
+	} else if a.isAny() {
+		return b, true
+	} else if (a.Elem == nil) != (b.Elem == nil) {
+		return a, false
+	}
+	s := a.ranges().intersect(b.ranges())
+	if len(s) == 0 {
+		return a, false
+	}
+	c, ok := congruenceMeet(a.congruence(), b.congruence())
+	if !ok {
+		return a, false
+	}
+	t, ok := a.withRanges(s).withStride(c)
+	if !ok || t.Elem == nil {
+		return t, ok
+	}
+	return meetElems(t, b)
+}
+
+// Returns true if t places no constraint on a value, which may be a list.
+func (t Type) isAny() bool {
+	return t.Range == UNDEF && t.Elem == nil && t.Set == nil && t.Stride.Mod < 2
+}
+
+// Returns the list t with at most n elements, and false if it can't have so
+// few.
+func shorten(t Type, n int) (Type, bool) {
+	s := t.ranges().intersect(RangeSet{{0, n}})
+	if len(s) == 0 {
+		return t, false
+	}
+	return trimPrefix(t.withRanges(s)), true
+}
+
+// Drops the types of leading elements that the list t cannot have, or that
+// say no more than its Elem.
+func trimPrefix(t Type) Type {
+	n := len(t.Prefix)
+	if n > maxPrefix {
+		n = maxPrefix
+	}
+	if t.End < n {
+		n = t.End
+	}
+	if n < 0 {
+		n = 0
+	}
+	for n > 0 && t.Elem.SubsetOf(t.Prefix[n-1]) {
+		n--
+	}
+	if n == 0 {
+		t.Prefix = nil
+	} else {
+		t.Prefix = t.Prefix[:n:n]
+	}
+	return t
+}
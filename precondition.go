@@ -0,0 +1,346 @@
+package madison
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// How many times a function's precondition is recomputed while its
+// recursive calls settle.
+const preconditionSteps = 8
+
+// The argument types under which a function returns without failing.
+type Precondition struct {
+	// The function being called.
+	Name string
+
+	// What its arguments need to be.
+	Args []Type
+
+	// Why no precondition could be found, if none could.
+	Err error
+
+	// Whether Args are only known to be enough: where the paths through the
+	// function need different things, they demand all of them, so the
+	// function may also be safe for arguments outside them.
+	Sufficient bool
+
+	// What its arguments could be, were there no precondition.
+	free []Type
+
+	// What its arguments are called, where they have names.
+	params []string
+}
+
+// Pretty-prints the arguments that are constrained by the precondition.
+func (p Precondition) String() string {
+	if p.Err != nil {
+		return fmt.Sprintf("%s may always fail: %s", p.Name, p.Err)
+	}
+	var needs []string
+	for i, arg := range p.Args {
+		if p.free[i].SubsetOf(arg) {
+			continue
+		}
+		name := fmt.Sprintf("argument %d", i+1)
+		if i < len(p.params) && p.params[i] != "" {
+			name = p.params[i]
+		}
+		needs = append(needs, fmt.Sprintf("%s :: %s", name, arg))
+	}
+	if len(needs) == 0 {
+		return fmt.Sprintf("%s requires nothing", p.Name)
+	} else if p.Sufficient {
+		return fmt.Sprintf("%s is safe if %s", p.Name, strings.Join(needs, ", "))
+	}
+	return fmt.Sprintf("%s requires %s", p.Name, strings.Join(needs, ", "))
+}
+
+// The state of a search for preconditions.
+type preconditions struct {
+	*Runtime
+
+	// Whether to demand the requirements of both branches of every If,
+	// rather than joining what each needs.
+	strict bool
+
+	// The (current guess at the) precondition of each function.
+	found map[string]guess
+
+	// The kind of each argument of each function.
+	shapes map[string][]Type
+}
+
+// A precondition, or the reason there isn't one.
+type guess struct {
+	args []Type
+	err  error
+}
+
+// Computes a precondition for each function in the runtime, in order of
+// name. Each is checked with Type to be sufficient, but need not be the
+// weakest: where a function needs different things on different paths, it
+// may demand all of them (and is then marked Sufficient).
+func (r *Runtime) Preconditions() []Precondition {
+	names := make([]string, 0, len(r.Funcs))
+	for name := range r.Funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pres := make([]Precondition, len(names))
+	for i, name := range names {
+		for _, strict := range []bool{false, true} {
+			p := &preconditions{r, strict, map[string]guess{}, map[string][]Type{}}
+			args, err := p.of(name)
+			if err == nil {
+				err = r.verify(name, args)
+			}
+			pres[i] = Precondition{name, args, err, strict, p.shape(name), r.params[name]}
+			if err == nil {
+				break
+			}
+		}
+	}
+	return pres
+}
+
+// Checks that calling name with args cannot fail.
+func (r *Runtime) verify(name string, args []Type) error {
+	vars := make([]Node, len(args))
+	for i := range vars {
+		vars[i] = &Var{i}
+	}
+	_, err := (&Apply{r, name, vars}).Type(nil, args)
+	if err == errDiverges {
+		return nil
+	}
+	return err
+}
+
+// Computes the precondition of the named function.
+func (p *preconditions) of(name string) ([]Type, error) {
+	if sig, ok := p.Signatures[name]; ok {
+		return sig.Args, nil
+	} else if g, ok := p.found[name]; ok {
+		return g.args, g.err
+	}
+	funct, ok := p.Funcs[name]
+	if !ok {
+		return nil, fmt.Errorf("undefined function %s", name)
+	}
+
+	args := p.shape(name)
+	p.found[name] = guess{args, nil}
+	for i := 0; i < preconditionSteps; i++ {
+		next := append([]Type(nil), args...)
+		if err := p.require(funct, next); err != nil {
+			p.found[name] = guess{nil, err}
+			return nil, err
+		}
+		if subsetOf(args, next) {
+			break
+		}
+		args = next
+		p.found[name] = guess{args, nil}
+	}
+	return args, nil
+}
+
+// Narrows locals so that n cannot fail, returning an error if it always
+// does.
+func (p *preconditions) require(n Node, locals []Type) error {
+	switch n := n.(type) {
+	case *Undef:
+		return errors.New(n.Message)
+	case *If:
+		if err := p.require(n.Cond, locals); err != nil {
+			return err
+		}
+		return p.branch(n, locals)
+	case *Let:
+		if err := p.require(n.Value, locals); err != nil {
+			return err
+		}
+		v, err := n.Value.Type(nil, locals)
+		if err != nil {
+			return err
+		}
+		lcls := make([]Type, n.scope(len(locals)))
+		copy(lcls, locals)
+		unrelate(lcls, n.Index)
+		lcls[n.Index] = v
+		if err := p.require(n.Body, lcls); err != nil {
+			return err
+		}
+		unrelate(lcls, n.Index)
+		for i := range locals {
+			if i != n.Index {
+				locals[i] = lcls[i]
+			}
+		}
+		return nil
+	}
+
+	for _, child := range children(n) {
+		if err := p.require(child, locals); err != nil {
+			return err
+		}
+	}
+
+	switch n := n.(type) {
+	case *Head:
+		return restrict(n.List, locals, nonEmpty)
+	case *Tail:
+		return restrict(n.List, locals, nonEmpty)
+	case *Divide:
+		return nonZero(n.B, locals)
+	case *Modulo:
+		return nonZero(n.B, locals)
+	case *Apply:
+		if err := n.arity(); err != nil {
+			return err
+		}
+		args, err := p.of(n.Name)
+		if err != nil {
+			return err
+		}
+		for i, arg := range n.Args {
+			if err := restrict(arg, locals, args[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Narrows locals so that whichever branch of n is taken cannot fail.
+func (p *preconditions) branch(n *If, locals []Type) error {
+	lte := append([]Type(nil), locals...)
+	lerr := n.Cond.RestrictTo(nil, lte, NON_POSITIVE)
+	if lerr == nil {
+		lerr = p.require(n.NonPositive, lte)
+	}
+	gte := append([]Type(nil), locals...)
+	gerr := n.Cond.RestrictTo(nil, gte, POSITIVE)
+	if gerr == nil {
+		gerr = p.require(n.Positive, gte)
+	}
+
+	switch {
+	case lerr != nil && gerr != nil:
+		return lerr
+	case lerr != nil:
+		copy(locals, gte)
+	case gerr != nil:
+		copy(locals, lte)
+	case p.strict:
+		if err := p.require(n.NonPositive, locals); err != nil {
+			return err
+		}
+		return p.require(n.Positive, locals)
+	default:
+		for i := range locals {
+			t, err := TypesUnion(lte[i], gte[i])
+			if err != nil {
+				return err
+			}
+			locals[i] = t
+		}
+	}
+	return nil
+}
+
+// A list with at least one element.
+var nonEmpty = Type{Range: Range{1, math.MaxInt32}, Elem: &Type{Range: UNDEF}}
+
+// Narrows locals so that n has type t, unless it already does.
+func restrict(n Node, locals []Type, t Type) error {
+	if typ, err := n.Type(nil, locals); err == nil && typ.SubsetOf(t) {
+		return nil
+	}
+	return n.RestrictTo(nil, locals, t)
+}
+
+// Narrows locals so that the divisor n cannot be zero.
+func nonZero(n Node, locals []Type) error {
+	typ, err := n.Type(nil, locals)
+	if err != nil {
+		return err
+	} else if typ.End > 0 {
+		return restrict(n, locals, POSITIVE)
+	}
+	return restrict(n, locals, InRange(math.MinInt32, -1))
+}
+
+// Computes what each argument of the named function could be: a list if the
+// function (or one it calls) takes its length, head or tail, and otherwise
+// any integer.
+func (p *preconditions) shape(name string) []Type {
+	if args, ok := p.shapes[name]; ok {
+		return args
+	}
+	n, ok := p.arity[name]
+	if !ok {
+		n = arguments(p.Funcs[name])
+	}
+	args := make([]Type, n)
+	for i := range args {
+		args[i] = Type{Range: UNDEF}
+	}
+	p.shapes[name] = args
+	p.lists(p.Funcs[name], args)
+	return args
+}
+
+// Marks each argument of args that n uses as a list.
+func (p *preconditions) lists(n Node, args []Type) {
+	var used []Node
+	switch n := n.(type) {
+	case *Head:
+		used = []Node{n.List}
+	case *Tail:
+		used = []Node{n.List}
+	case *length:
+		used = []Node{n.List}
+	case *Prepend:
+		used = []Node{n.Tail}
+	case *Apply:
+		if _, ok := p.Funcs[n.Name]; ok {
+			for i, t := range p.shape(n.Name) {
+				if t.Elem != nil && i < len(n.Args) {
+					used = append(used, n.Args[i])
+				}
+			}
+		}
+	}
+	for _, u := range used {
+		if v, ok := unlocated(u).(*Var); ok && v.index < len(args) {
+			args[v.index] = Type{Range: Range{0, math.MaxInt32},
+				Elem: &Type{Range: UNDEF}}
+		}
+	}
+	for _, child := range children(n) {
+		p.lists(child, args)
+	}
+}
+
+// Counts the arguments n refers to, for functions not defined by parsing.
+func arguments(n Node) int {
+	count := 0
+	if v, ok := unlocated(n).(*Var); ok {
+		count = v.index + 1
+	}
+	for _, child := range children(n) {
+		if c := arguments(child); c > count {
+			count = c
+		}
+	}
+	if l, ok := n.(*Let); ok && count == l.Index+1 {
+		count = arguments(l.Value)
+	}
+	return count
+}
@@ -3,6 +3,8 @@ package madison
 import (
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 )
 
 // A range of integers.
@@ -54,18 +56,230 @@ func union(a, b Range) (o Range) {
 	return
 }
 
+func widen(a, b Range) Range {
+	if b.Start < a.Start {
+		a.Start = math.MinInt32
+	}
+	if b.End > a.End {
+		a.End = math.MaxInt32
+	}
+	return a
+}
+
 func conv(a, b Range) Range {
-	st := a.Start + b.Start
+	st := saturate(a.Start + b.Start)
 	if a.Start == math.MinInt32 || b.Start == math.MinInt32 {
 		st = math.MinInt32
 	}
-	ed := a.End + b.End
+	ed := saturate(a.End + b.End)
 	if a.End == math.MaxInt32 || b.End == math.MaxInt32 {
 		ed = math.MaxInt32
 	}
 	return Range{st, ed}
 }
 
+// Rounds a bound that is out of range to the nearest infinity.
+func saturate(x int) int {
+	if x <= math.MinInt32 {
+		return math.MinInt32
+	} else if x >= math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return x
+}
+
+// Multiplies two (possibly infinite) bounds.
+func mulBound(x, y int) int {
+	if x == 0 || y == 0 {
+		return 0
+	}
+	neg := (x < 0) != (y < 0)
+	p := x * y
+	if x == math.MinInt32 || x == math.MaxInt32 ||
+		y == math.MinInt32 || y == math.MaxInt32 ||
+		p <= math.MinInt32 || p >= math.MaxInt32 {
+		if neg {
+			return math.MinInt32
+		}
+		return math.MaxInt32
+	}
+	return p
+}
+
+// Divides two (possibly infinite) bounds, rounding up or down. Divisor y
+// must not be zero.
+func divBound(x, y int, up bool) int {
+	if x == 0 {
+		return 0
+	}
+	neg := (x < 0) != (y < 0)
+	if x == math.MinInt32 || x == math.MaxInt32 {
+		if neg {
+			return math.MinInt32
+		}
+		return math.MaxInt32
+	}
+	if y == math.MinInt32 || y == math.MaxInt32 {
+		return 0
+	}
+	q := x / y
+	if x%y != 0 && up != neg {
+		if up {
+			q++
+		} else {
+			q--
+		}
+	}
+	return q
+}
+
+func mul(a, b Range) Range {
+	o := Range{math.MaxInt32, math.MinInt32}
+	for _, x := range []int{a.Start, a.End} {
+		for _, y := range []int{b.Start, b.End} {
+			if p := mulBound(x, y); p < o.Start {
+				o.Start = p
+			}
+			if p := mulBound(x, y); p > o.End {
+				o.End = p
+			}
+		}
+	}
+	return o
+}
+
+// Divides a by b (rounding towards zero, as Go does). Divisor b must not
+// contain zero.
+func quo(a, b Range) Range {
+	o := Range{math.MaxInt32, math.MinInt32}
+	for _, x := range []int{a.Start, a.End} {
+		for _, y := range []int{b.Start, b.End} {
+			q := divBound(x, y, (x < 0) != (y < 0))
+			if q < o.Start {
+				o.Start = q
+			}
+			if q > o.End {
+				o.End = q
+			}
+		}
+	}
+	return o
+}
+
+// Computes the remainder of a divided by b (taking the sign of a, as Go
+// does). Divisor b must not contain zero.
+func rem(a, b Range) Range {
+	lo, hi := abs(b.Start), abs(b.End)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if a.Start >= 0 && a.End < lo || a.End <= 0 && -a.Start < lo {
+		return a // |a| < |b|, so a % b = a
+	}
+	if hi < math.MaxInt32 {
+		hi--
+	}
+	o := Range{-hi, hi}
+	if hi == math.MaxInt32 {
+		o.Start = math.MinInt32
+	}
+	if a.Start > o.Start {
+		o.Start = a.Start
+	}
+	if a.End < o.End {
+		o.End = a.End
+	}
+	if a.Start >= 0 {
+		o.Start = 0
+	}
+	if a.End <= 0 {
+		o.End = 0
+	}
+	return o
+}
+
+// Computes the magnitude of a (possibly infinite) bound.
+func abs(x int) int {
+	if x == math.MinInt32 {
+		return math.MaxInt32
+	} else if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Finds the values x such that x * y lies in t, for some y in b.
+func factor(t, b Range) []Range {
+	zero := Range{0, 0}
+	if len(intersect(t, zero)) > 0 && len(intersect(b, zero)) > 0 {
+		return []Range{UNDEF}
+	}
+	found := []Range{}
+	for _, d := range subtract(b, zero) {
+		o := Range{math.MaxInt32, math.MinInt32}
+		for _, x := range []int{t.Start, t.End} {
+			for _, y := range []int{d.Start, d.End} {
+				if q := divBound(x, y, true); q < o.Start {
+					o.Start = q
+				}
+				if q := divBound(x, y, false); q > o.End {
+					o.End = q
+				}
+			}
+		}
+		if o.Start > o.End {
+			continue
+		} else if len(found) > 0 {
+			found[0] = union(found[0], o)
+		} else {
+			found = append(found, o)
+		}
+	}
+	return found
+}
+
+// The opposite of each comparison operator.
+var negations = map[string]string{
+	"<": ">=", "<=": ">", "==": "!=", "!=": "==", ">=": "<", ">": "<=",
+}
+
+// Narrows a and b to the values for which "a op b" may hold, returning false
+// if it never does.
+func compare(op string, a, b RangeSet) (RangeSet, RangeSet, bool) {
+	var as, bs RangeSet
+	switch op {
+	case "<":
+		as = a.intersect(RangeSet{{math.MinInt32, conv(b.hull(), Range{-1, -1}).End}})
+		bs = b.intersect(RangeSet{{conv(a.hull(), Range{1, 1}).Start, math.MaxInt32}})
+	case "<=":
+		as = a.intersect(RangeSet{{math.MinInt32, b.hull().End}})
+		bs = b.intersect(RangeSet{{a.hull().Start, math.MaxInt32}})
+	case ">":
+		b, a, ok := compare("<", b, a)
+		return a, b, ok
+	case ">=":
+		b, a, ok := compare("<=", b, a)
+		return a, b, ok
+	case "==":
+		as = a.intersect(b)
+		bs = as
+	case "!=":
+		as, bs = a, b
+		if len(b) == 1 && b[0].IsConst() {
+			as = a.subtract(b)
+		}
+		if len(a) == 1 && a[0].IsConst() {
+			bs = b.subtract(a)
+		}
+	default:
+		panic(fmt.Sprintf("unknown comparison %s", op))
+	}
+	if len(as) == 0 || len(bs) == 0 {
+		return a, b, false
+	}
+	return as, bs, true
+}
+
 func (r Range) IsConst() bool {
 	return r.Start == r.End // Start cannot be +inf, and End cannot be -inf
 }
@@ -103,3 +317,110 @@ func subtract(a Range, b Range) []Range {
 	}
 	return []Range{a}
 }
+
+// How many disjoint ranges a RangeSet keeps before merging the closest.
+const maxPieces = 8
+
+// A sorted list of disjoint, non-adjacent ranges.
+type RangeSet []Range
+
+// Makes the RangeSet holding every value in any of the given ranges.
+func Ranges(rs ...Range) RangeSet {
+	s := append(RangeSet(nil), rs...)
+	sort.Slice(s, func(i, j int) bool { return s[i].Start < s[j].Start })
+	out := RangeSet{}
+	for _, r := range s {
+		if n := len(out); n > 0 && (out[n-1].End == math.MaxInt32 ||
+			r.Start <= out[n-1].End+1) {
+			out[n-1] = union(out[n-1], r)
+		} else {
+			out = append(out, r)
+		}
+	}
+	for len(out) > maxPieces {
+		closest := 0
+		for i := 1; i < len(out)-1; i++ {
+			if out[i+1].Start-out[i].End < out[closest+1].Start-out[closest].End {
+				closest = i
+			}
+		}
+		out[closest] = union(out[closest], out[closest+1])
+		out = append(out[:closest+1], out[closest+2:]...)
+	}
+	return out
+}
+
+// Pretty-prints this RangeSet, with each range in brackets.
+func (s RangeSet) String() string {
+	pieces := make([]string, len(s))
+	for i, r := range s {
+		if pieces[i] = r.String(); r.IsConst() || r == UNDEF {
+			pieces[i] = "[" + pieces[i] + "]"
+		}
+	}
+	return strings.Join(pieces, " ∪ ")
+}
+
+// Returns true if v is in s.
+func (s RangeSet) contains(v int) bool {
+	for _, r := range s {
+		if r.Start <= v && v <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// The smallest Range holding every value in s, which must not be empty.
+func (s RangeSet) hull() Range {
+	return Range{s[0].Start, s[len(s)-1].End}
+}
+
+// The values in either s or o.
+func (s RangeSet) union(o RangeSet) RangeSet {
+	return Ranges(append(append([]Range(nil), s...), o...)...)
+}
+
+// The values in both s and o.
+func (s RangeSet) intersect(o RangeSet) RangeSet {
+	var out []Range
+	for _, a := range s {
+		for _, b := range o {
+			out = append(out, intersect(a, b)...)
+		}
+	}
+	return Ranges(out...)
+}
+
+// The values in s but not o.
+func (s RangeSet) subtract(o RangeSet) RangeSet {
+	out := s
+	for _, b := range o {
+		var next []Range
+		for _, a := range out {
+			next = append(next, subtract(a, b)...)
+		}
+		out = next
+	}
+	return Ranges(out...)
+}
+
+// The negation of each value in s.
+func (s RangeSet) negate() RangeSet {
+	out := make([]Range, len(s))
+	for i, r := range s {
+		out[i] = inverse(r)
+	}
+	return Ranges(out...)
+}
+
+// The sum of each value in s with each value in o.
+func (s RangeSet) add(o RangeSet) RangeSet {
+	var out []Range
+	for _, a := range s {
+		for _, b := range o {
+			out = append(out, conv(a, b))
+		}
+	}
+	return Ranges(out...)
+}
@@ -1,6 +1,7 @@
 package madison
 
 import (
+	"fmt"
 	"math"
 	"testing"
 )
@@ -37,6 +38,36 @@ var doubles = []struct {
 	{conv, Range{ninf, 1}, Range{1, 2}, Range{ninf, 3}},
 	{conv, Range{ninf, 1}, Range{1, inf}, Range{ninf, inf}},
 	{conv, Range{-1, 1}, Range{1, inf}, Range{0, inf}},
+
+	{mul, Range{2, 3}, Range{4, 5}, Range{8, 15}},
+	{mul, Range{-2, 3}, Range{4, 5}, Range{-10, 15}},
+	{mul, Range{-2, 3}, Range{-5, 4}, Range{-15, 12}},
+	{mul, Range{0, 0}, Range{ninf, inf}, Range{0, 0}},
+	{mul, Range{1, inf}, Range{-2, -1}, Range{ninf, -1}},
+	{mul, Range{-1, inf}, Range{1, inf}, Range{ninf, inf}},
+
+	{quo, Range{7, 9}, Range{2, 3}, Range{2, 4}},
+	{quo, Range{-7, 9}, Range{2, 2}, Range{-3, 4}},
+	{quo, Range{1, inf}, Range{-2, -1}, Range{ninf, 0}},
+
+	{rem, Range{0, 100}, Range{1, 10}, Range{0, 9}},
+	{rem, Range{-5, 5}, Range{7, 8}, Range{-5, 5}},
+	{rem, Range{-20, -1}, Range{3, 4}, Range{-3, 0}},
+	{rem, Range{ninf, inf}, Range{1, inf}, Range{ninf, inf}},
+}
+
+var factors = []struct {
+	Prod Range
+	By   Range
+	Exp  []Range
+}{
+	{Range{8, 15}, Range{4, 5}, []Range{{2, 3}}},
+	{Range{1, 1}, Range{2, 2}, []Range{}},
+	{Range{-6, 6}, Range{-2, 2}, []Range{UNDEF}},
+	{Range{1, 10}, Range{0, 0}, []Range{}},
+	{Range{1, 10}, Range{-2, 2}, []Range{{-10, 10}}},
+	{Range{1, inf}, Range{1, 2}, []Range{{1, inf}}},
+	{Range{3, 3}, Range{1, inf}, []Range{{0, 3}}},
 }
 
 func TestRange(t *testing.T) {
@@ -53,4 +84,91 @@ func TestRange(t *testing.T) {
 			t.Errorf("%d: (%s, %s) = %s (expecting %s)", i, c.Arg1, c.Arg2, got, c.Exp)
 		}
 	}
+	for i, c := range factors {
+		got := factor(c.Prod, c.By)
+		if fmt.Sprint(got) != fmt.Sprint(c.Exp) {
+			t.Errorf("%d: factor(%s, %s) = %s (expecting %s)", i, c.Prod, c.By, got, c.Exp)
+		}
+	}
+}
+
+var sets = []struct {
+	Op   func(a, b RangeSet) RangeSet
+	Arg1 RangeSet
+	Arg2 RangeSet
+	Exp  string
+}{
+	{RangeSet.union, Ranges(Range{0, 1}), Ranges(Range{3, 4}), "[0, 1] ∪ [3, 4]"},
+	{RangeSet.union, Ranges(Range{0, 1}), Ranges(Range{2, 4}), "[0, 4]"},
+	{RangeSet.union, Ranges(Range{ninf, 1}), Ranges(Range{0, inf}), "[any]"},
+	{RangeSet.intersect, Ranges(Range{0, 2}, Range{5, 9}), Ranges(Range{1, 6}),
+		"[1, 2] ∪ [5, 6]"},
+	{RangeSet.intersect, Ranges(Range{0, 2}), Ranges(Range{3, 4}), ""},
+	{RangeSet.subtract, Ranges(UNDEF), Ranges(Range{0, 1}),
+		"(-∞, -1] ∪ [2, ∞)"},
+	{RangeSet.subtract, Ranges(Range{0, 9}), Ranges(Range{0, 0}, Range{9, 9}),
+		"[1, 8]"},
+	{RangeSet.add, Ranges(Range{0, 0}, Range{10, 10}), Ranges(Range{1, 2}),
+		"[1, 2] ∪ [11, 12]"},
+	{RangeSet.add, Ranges(Range{0, 0}, Range{3, 3}), Ranges(Range{0, 3}),
+		"[0, 6]"},
+	{func(a, _ RangeSet) RangeSet { return a.negate() },
+		Ranges(Range{ninf, -1}, Range{2, inf}), nil, "(-∞, -2] ∪ [1, ∞)"},
+}
+
+func TestRangeSet(t *testing.T) {
+	for i, c := range sets {
+		if got := c.Op(c.Arg1, c.Arg2); got.String() != c.Exp {
+			t.Errorf("%d: (%s, %s) = %s (expecting %s)", i, c.Arg1, c.Arg2, got, c.Exp)
+		}
+	}
+
+	many := make([]Range, 2*maxPieces)
+	for i := range many {
+		many[i] = Range{i * i, i * i}
+	}
+	if got := Ranges(many...); len(got) != maxPieces || got.hull() != (Range{0, 225}) {
+		t.Errorf("Ranges(%v) = %s (expecting %d pieces)", many, got, maxPieces)
+	}
+}
+
+var congruences = []struct {
+	Op   func(a, b Congruence) Congruence
+	Arg1 Congruence
+	Arg2 Congruence
+	Exp  Congruence
+}{
+	{congruenceSum, Congruence{4, 1}, Congruence{6, 2}, Congruence{2, 1}},
+	{congruenceSum, Congruence{4, 3}, Congruence{0, 1}, Congruence{4, 0}},
+	{congruenceProduct, Congruence{0, 4}, Congruence{1, 0}, Congruence{4, 0}},
+	{congruenceProduct, Congruence{6, 2}, Congruence{4, 1}, Congruence{2, 0}},
+	{congruenceUnion, Congruence{0, 3}, Congruence{0, 7}, Congruence{4, 3}},
+	{congruenceUnion, Congruence{4, 1}, Congruence{6, 1}, Congruence{2, 1}},
+	{congruenceUnion, Congruence{4, 1}, Congruence{4, 2}, Congruence{1, 0}},
+	{func(a, _ Congruence) Congruence { return congruenceNegation(a) },
+		Congruence{5, 2}, Congruence{}, Congruence{5, 3}},
+}
+
+func TestCongruence(t *testing.T) {
+	for i, c := range congruences {
+		if got := c.Op(c.Arg1, c.Arg2); got != c.Exp {
+			t.Errorf("%d: (%v, %v) = %v (expecting %v)", i, c.Arg1, c.Arg2, got, c.Exp)
+		}
+	}
+	if _, ok := congruenceMeet(Congruence{4, 1}, Congruence{2, 0}); ok {
+		t.Errorf("odd and even numbers should not meet")
+	}
+	if got, ok := congruenceMeet(Congruence{2, 1}, Congruence{6, 3}); !ok || got != (Congruence{6, 3}) {
+		t.Errorf("meet(%v, %v) = %v", Congruence{2, 1}, Congruence{6, 3}, got)
+	}
+
+	// The lengths of lists have no stride.
+	one := Type{Range: Range{1, 1}, Elem: &Type{Range: Range{0, 0}}}
+	three := Type{Range: Range{3, 3}, Elem: &Type{Range: Range{0, 0}}}
+	if got, _ := TypesUnion(one, three); got.Stride.Mod > 1 {
+		t.Errorf("TypesUnion(%s, %s) = %s", one, three, got)
+	}
+	if got := TypesWiden(one, three); got.Stride.Mod > 1 {
+		t.Errorf("TypesWiden(%s, %s) = %s", one, three, got)
+	}
 }
@@ -0,0 +1,110 @@
+package madison
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Checks that every function called in the runtime is defined and given as
+// many arguments as it takes, returning ParseErrors for any that are not.
+func (r *Runtime) Resolve() error {
+	names := make([]string, 0, len(r.Funcs))
+	for name := range r.Funcs {
+		names = append(names, name)
+	}
+	return r.resolveNames(names)
+}
+
+// Checks the calls made by the named functions, as Resolve does.
+func (r *Runtime) resolveNames(names []string) error {
+	sort.Strings(names)
+
+	var errs ParseErrors
+	for _, name := range names {
+		errs = r.resolve(r.Funcs[name], Span{}, errs)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Span, errs[j].Span
+		if a.File != b.File {
+			return a.File < b.File
+		} else if a.Start.Line != b.Start.Line {
+			return a.Start.Line < b.Start.Line
+		}
+		return a.Start.Col < b.Start.Col
+	})
+	return errs
+}
+
+// Appends a ParseError to errs for each bad call within n, which came from
+// span (unless a Located inside says otherwise).
+func (r *Runtime) resolve(n Node, span Span, errs ParseErrors) ParseErrors {
+	switch n := n.(type) {
+	case *Located:
+		span = n.Span
+	case *Apply:
+		if _, ok := r.Funcs[n.Name]; !ok {
+			message := fmt.Sprintf("undefined name %s", n.Name)
+			if guess := r.suggest(n.Name); guess != "" {
+				message += fmt.Sprintf(" (did you mean %s?)", guess)
+			}
+			errs = append(errs, &ParseError{NameError, message, span})
+		} else if k, ok := r.arity[n.Name]; ok && k != len(n.Args) {
+			errs = append(errs, &ParseError{ArityError, fmt.Sprintf(
+				"%s takes %d arguments, got %d", n.Name, k, len(n.Args)), span})
+		}
+	}
+	for _, child := range children(n) {
+		errs = r.resolve(child, span, errs)
+	}
+	return errs
+}
+
+// Returns the defined function or builtin whose name is closest to name, or
+// "" if none are close enough to be a likely typo.
+func (r *Runtime) suggest(name string) string {
+	best, bestDistance := "", len(name)/3+1
+	consider := func(candidate string) {
+		d := distance(name, candidate)
+		if d < bestDistance || d == bestDistance && candidate < best {
+			best, bestDistance = candidate, d
+		}
+	}
+	for candidate := range r.Funcs {
+		consider(candidate)
+	}
+	for candidate := range builtins {
+		consider(candidate)
+	}
+	return best
+}
+
+// Computes the edit distance between a and b.
+func distance(a, b string) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			next := diagonal + cost
+			if row[j]+1 < next {
+				next = row[j] + 1
+			}
+			if row[j-1]+1 < next {
+				next = row[j-1] + 1
+			}
+			diagonal, row[j] = row[j], next
+		}
+	}
+	return row[len(b)]
+}
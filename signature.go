@@ -0,0 +1,144 @@
+package madison
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Declares the types a function accepts and returns, as in
+// clamp :: [0, 100] -> [0, 10].
+type Signature struct {
+	Args   []Type
+	Result Type
+}
+
+// Pretty-prints this signature.
+func (s Signature) String() string {
+	if len(s.Args) == 0 {
+		return s.Result.String()
+	}
+	return fmt.Sprintf("%s -> %s", typesString(s.Args), s.Result)
+}
+
+// Represents a function whose body doesn't fit its signature.
+type SignatureError struct {
+	// The function being checked.
+	Name string
+
+	// What the function was declared to do.
+	Signature Signature
+
+	// What the body of the function may return.
+	Found Type
+}
+
+// Represent the mismatch as an error.
+func (s *SignatureError) Error() string {
+	return fmt.Sprintf("%s :: %s, but it may return %s",
+		s.Name, s.Signature, s.Found)
+}
+
+// Computes the result of calling a function with the given signature, which
+// must accept args.
+func (s Signature) apply(args []Type) (Type, error) {
+	if len(args) != len(s.Args) || !subsetOf(args, s.Args) {
+		return NIL, fmt.Errorf("arguments %s are outside the declared %s",
+			typesString(args), typesString(s.Args))
+	}
+	return s.Result, nil
+}
+
+// Checks the body of every function that has a signature against it,
+// assuming that the calls it makes (including recursive ones) fit their
+// own signatures.
+func (r *Runtime) Check() error {
+	names := make([]string, 0, len(r.Signatures))
+	for name := range r.Signatures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sig := r.Signatures[name]
+		funct, ok := r.Funcs[name]
+		if !ok {
+			return fmt.Errorf("signature given for undefined function %s", name)
+		}
+		if n, ok := r.arity[name]; ok && n != len(sig.Args) {
+			return fmt.Errorf("%s takes %d arguments, but its signature has %d",
+				name, n, len(sig.Args))
+		}
+
+		callers := []CallSite{{Name: name, Args: sig.Args, runtime: r}}
+		typ, err := funct.Type(callers, sig.Args)
+		if err == errDiverges {
+			continue // never returns, so never returns the wrong thing
+		} else if _, ok := err.(*CallError); !ok && err != nil {
+			return &CallError{callers, err}
+		} else if err != nil {
+			return err
+		}
+		if !typ.SubsetOf(sig.Result) {
+			return &SignatureError{name, sig, typ}
+		}
+	}
+	return nil
+}
+
+// Parses a signature declaration, name :: args -> result, where at is the
+// index of the ::.
+func (c *converter) signature(src source, at int) {
+	name := src.slice(0, at).trim()
+	if !isName(name.text) || strings.ContainsAny(name.text, " \t") {
+		c.fail(SyntaxError, nil, "cannot declare a signature for %s", name.text)
+	}
+
+	decl := src.slice(at+len("::"), len(src.text))
+	var pieces []source
+	result := decl
+	if arrow := strings.LastIndex(decl.text, "->"); arrow >= 0 {
+		result = decl.slice(arrow+len("->"), len(decl.text))
+		pieces = splitTypes(decl.slice(0, arrow))
+	}
+
+	sig := Signature{Args: make([]Type, len(pieces))}
+	for i, piece := range append(pieces, result) {
+		piece = piece.trim()
+		typ, err := ParseType(piece.text)
+		if err != nil {
+			panic(&ParseError{SyntaxError, err.Error(),
+				Span{c.line.File, piece.at(0), piece.at(len(piece.text))}})
+		}
+		if i < len(pieces) {
+			sig.Args[i] = typ
+		} else {
+			sig.Result = typ
+		}
+	}
+
+	if c.Signatures == nil {
+		c.Signatures = map[string]Signature{}
+	}
+	c.Signatures[name.text] = sig
+	c.forget()
+}
+
+// Splits a list of types at the commas outside of brackets.
+func splitTypes(src source) (pieces []source) {
+	depth, start := 0, 0
+	for i, ch := range src.text {
+		switch ch {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				pieces = append(pieces, src.slice(start, i))
+				start = i + 1
+			}
+		}
+	}
+	return append(pieces, src.slice(start, len(src.text)))
+}
@@ -0,0 +1,67 @@
+package madison
+
+// Identifies a function applied to a particular argument, under the options
+// it was analysed with.
+type summaryKey struct {
+	Name, Args string
+
+	Relational, Prefixes bool
+	Sensitivity          int
+}
+
+// Returns the key of the call of name with args, under the options of r.
+func (r *Runtime) key(name string, args []Type) summaryKey {
+	return summaryKey{name, typesString(args), r.Relational, r.Prefixes, r.Sensitivity}
+}
+
+// The outcome of analysing a function call.
+type summary struct {
+	Result Type
+	Err    error
+
+	// The calls nested under the failing call, if Err is a *CallError.
+	trail []CallSite
+}
+
+// Looks up a previously computed call of name with args.
+func (r *Runtime) summary(name string, args []Type) (summary, bool) {
+	s, ok := r.summaries[r.key(name, args)]
+	return s, ok
+}
+
+// Records the outcome of the call of name with args (the last entry of
+// callers).
+func (r *Runtime) remember(name string, args []Type, callers []CallSite,
+	typ Type, err error) {
+
+	if r.summaries == nil {
+		r.summaries = map[summaryKey]summary{}
+	}
+	s := summary{Result: typ, Err: err}
+	if cerr, ok := err.(*CallError); ok {
+		s.Err = cerr.Err
+		s.trail = cerr.Callers
+		own := callers[len(callers)-1].frame
+		for i, site := range cerr.Callers {
+			if site.frame == own {
+				s.trail = cerr.Callers[i+1:]
+			}
+		}
+	}
+	r.summaries[r.key(name, args)] = s
+}
+
+// Replays a remembered outcome as though it had been computed with the given
+// callers.
+func (s summary) replay(callers []CallSite) (Type, error) {
+	if s.Err == nil || s.Err == errDiverges {
+		return s.Result, s.Err
+	}
+	chain := append(callers[:len(callers):len(callers)], s.trail...)
+	return NIL, &CallError{callers[len(callers)-1].runtime.context(chain), s.Err}
+}
+
+// Forgets every remembered call (e.g. because a function was redefined).
+func (r *Runtime) forget() {
+	r.summaries = nil
+}
@@ -0,0 +1,324 @@
+package madison
+
+import (
+	"fmt"
+	"math"
+)
+
+// Where the arguments used to fit a symbolic summary start.
+const symbolicBase = 4
+
+// An affine function of the bounds of a call's arguments: Const, plus
+// Coeffs[i] times the bound of argument i (or its length, for a list) that
+// makes the result smallest for a lower bound, or largest for an upper one.
+type Affine struct {
+	Const  int
+	Coeffs []int
+}
+
+// Pretty-prints this function, naming the arguments x, y, z...
+func (a Affine) String() string {
+	s := ""
+	for i, c := range a.Coeffs {
+		if c == 0 {
+			continue
+		}
+		term := fmt.Sprintf("%d%s", abs(c), &Var{i})
+		if abs(c) == 1 {
+			term = (&Var{i}).String()
+		}
+		switch {
+		case s == "" && c < 0:
+			s = "-" + term
+		case s == "":
+			s = term
+		case c < 0:
+			s += " - " + term
+		default:
+			s += " + " + term
+		}
+	}
+	switch {
+	case s == "":
+		return fmt.Sprintf("%d", a.Const)
+	case a.Const < 0:
+		return fmt.Sprintf("%s - %d", s, -a.Const)
+	case a.Const > 0:
+		return fmt.Sprintf("%s + %d", s, a.Const)
+	}
+	return s
+}
+
+// Returns true if a and b are the same function.
+func (a Affine) equal(b Affine) bool {
+	if a.Const != b.Const || len(a.Coeffs) != len(b.Coeffs) {
+		return false
+	}
+	for i := range a.Coeffs {
+		if a.Coeffs[i] != b.Coeffs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Computes a for the given arguments, as an upper bound if upper is set, and
+// a lower bound otherwise.
+func (a Affine) bound(args []Type, upper bool) int {
+	sum := a.Const
+	for i, c := range a.Coeffs {
+		if c == 0 {
+			continue
+		}
+		b := args[i].Start
+		if (c > 0) == upper {
+			b = args[i].End
+		}
+		if b == math.MinInt32 || b == math.MaxInt32 {
+			if upper {
+				return math.MaxInt32
+			}
+			return math.MinInt32
+		}
+		sum += c * b
+	}
+	if sum <= math.MinInt32 {
+		return math.MinInt32
+	} else if sum >= math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return sum
+}
+
+// A result type whose bounds are affine in the bounds of the arguments.
+type Symbolic struct {
+	Start, End Affine
+
+	// If non-nil: the result is a list of Elem elements.
+	Elem *Symbolic
+}
+
+// Pretty-prints this type, in the form printed by Type.String.
+func (s Symbolic) String() string {
+	r := fmt.Sprintf("[%s, %s]", s.Start, s.End)
+	if s.Start.equal(s.End) {
+		r = "[" + s.Start.String() + "]"
+		if s.Elem == nil {
+			r = s.Start.String()
+		}
+	} else if s.Elem == nil {
+		r = "int" + r
+	}
+	if s.Elem != nil {
+		r += s.Elem.String()
+	}
+	return r
+}
+
+// Computes the result of a call with the given arguments.
+func (s Symbolic) At(args []Type) Type {
+	t := Type{Range: Range{s.Start.bound(args, false), s.End.bound(args, true)}}
+	if s.Elem != nil {
+		if t.Start < 0 {
+			t.Start = 0
+		}
+		elem := s.Elem.At(args)
+		if elem.Start > elem.End {
+			// No element fits, so the list must be empty.
+			t.Range, elem = Range{0, 0}, Type{Range: UNDEF}
+		}
+		t.Elem = &elem
+	}
+	return t
+}
+
+// Finds the result of the named function in terms of its arguments, and
+// records it in r.Symbolic, so that the calls the function makes to itself
+// use it rather than being analysed again.
+//
+// The summary is fitted to the results of Type at a few sample arguments,
+// then checked at some others (assuming any recursive calls within the
+// samples' range fit the summary). It is only used for calls whose arguments
+// lie within that range, and each of those is still checked against it:
+// where the function's body, given the summary for its own calls, doesn't
+// fit the summary, the call is analysed as though there were none.
+func (r *Runtime) Summarize(name string) (Symbolic, error) {
+	if _, ok := r.Funcs[name]; !ok {
+		return Symbolic{}, fmt.Errorf("undefined function %s", name)
+	}
+	if _, ok := r.Symbolic[name]; ok {
+		delete(r.Symbolic, name)
+		r.forget()
+	}
+	p := &preconditions{r, false, map[string]guess{}, map[string][]Type{}}
+	shape := p.shape(name)
+
+	// Sample each argument at the base, and one past it.
+	point := func(steps ...int) []Type {
+		args := make([]Type, len(shape))
+		for i := range args {
+			args[i] = shape[i]
+			args[i].Range = Range{symbolicBase + steps[i], symbolicBase + steps[i]}
+		}
+		return args
+	}
+	zero := make([]int, len(shape))
+	base, err := r.call(name, point(zero...))
+	if err != nil {
+		return Symbolic{}, err
+	}
+	steps := make([]Type, len(shape))
+	for i := range steps {
+		step := append([]int(nil), zero...)
+		step[i] = 1
+		if steps[i], err = r.call(name, point(step...)); err != nil {
+			return Symbolic{}, err
+		}
+	}
+	sym, ok := fit(base, steps)
+	if !ok {
+		return Symbolic{}, fmt.Errorf("%s has no affine summary", name)
+	}
+
+	// Check the summary elsewhere, assuming it for recursive calls.
+	if r.Symbolic == nil {
+		r.Symbolic = map[string]Symbolic{}
+	}
+	r.Symbolic[name] = sym
+	r.forget()
+	for _, args := range checkpoints(shape) {
+		typ, err := r.Funcs[name].Type([]CallSite{{Name: name, Args: args, runtime: r,
+			summarized: true}}, args)
+		if err == errDiverges {
+			continue
+		} else if err != nil || !typ.SubsetOf(sym.At(args)) {
+			delete(r.Symbolic, name)
+			r.forget()
+			return Symbolic{}, fmt.Errorf("%s :: %s fails for %s", name, sym,
+				typesString(args))
+		}
+	}
+	return sym, nil
+}
+
+// Computes the type of a call to a function with the summary sym: within the
+// body of a call that assumes it, the summary itself; and otherwise the body,
+// assuming the summary for the calls it makes to itself. Arguments below the
+// samples the summary was fitted and checked at are analysed without it.
+// Returns false if the call must be analysed without the summary, because
+// its arguments all lie there, or because the body doesn't fit it.
+func (a *Apply) summarized(sym Symbolic, funct Node, cs []CallSite,
+	args []Type) (Type, bool, error) {
+
+	for i, arg := range args {
+		if arg.Start >= symbolicBase {
+			continue
+		} else if arg.End < symbolicBase {
+			return NIL, false, nil
+		}
+
+		// Analyse the part below the samples without the summary, and the
+		// rest with it.
+		var parts []Type
+		for _, part := range []Range{{arg.Start, symbolicBase - 1},
+			{symbolicBase, arg.End}} {
+			values := arg.ranges().intersect(RangeSet{part})
+			if len(values) == 0 {
+				continue
+			}
+			split := append([]Type(nil), args...)
+			split[i] = arg.withRanges(values)
+			typ, err := a.call(cs, split)
+			if err != nil {
+				return NIL, true, err
+			}
+			parts = append(parts, typ)
+		}
+		typ := parts[0]
+		for _, part := range parts[1:] {
+			typ, _ = TypesUnion(typ, part)
+		}
+		return typ, true, nil
+	}
+	for i := len(cs) - 1; i >= 0; i-- {
+		if cs[i].Name != a.Name {
+			continue
+		} else if !cs[i].summarized {
+			return NIL, false, nil // already being analysed without it
+		}
+		for _, site := range cs[i+1:] {
+			if site.frame != nil {
+				site.frame.provisional = true
+			}
+		}
+		return sym.At(args), true, nil
+	}
+
+	callers := append(cs[:len(cs):len(cs)], CallSite{Name: a.Name, Args: args,
+		Context: a, summarized: true, runtime: a.Runtime})
+	typ, err := funct.Type(callers, args)
+	if _, ok := err.(*CallError); !ok && err != nil && err != errDiverges {
+		return NIL, true, &CallError{a.Runtime.context(callers), err}
+	} else if err != nil {
+		return NIL, true, err
+	}
+	return typ, typ.SubsetOf(sym.At(args)), nil
+}
+
+// Computes the result of calling name with args, without any summary of it.
+func (r *Runtime) call(name string, args []Type) (Type, error) {
+	vars := make([]Node, len(args))
+	for i := range vars {
+		vars[i] = &Var{i}
+	}
+	return (&Apply{r, name, vars}).Type(nil, args)
+}
+
+// Finds the affine bounds that give base at the sample arguments, and each of
+// steps when the corresponding argument is one larger.
+func fit(base Type, steps []Type) (Symbolic, bool) {
+	s := Symbolic{
+		Start: Affine{base.Start, make([]int, len(steps))},
+		End:   Affine{base.End, make([]int, len(steps))},
+	}
+	if base.Start == math.MinInt32 || base.End == math.MaxInt32 {
+		return s, false
+	}
+	var elems []Type
+	for i, step := range steps {
+		if (step.Elem == nil) != (base.Elem == nil) ||
+			step.Start == math.MinInt32 || step.End == math.MaxInt32 {
+			return s, false
+		}
+		s.Start.Coeffs[i] = step.Start - base.Start
+		s.End.Coeffs[i] = step.End - base.End
+		s.Start.Const -= s.Start.Coeffs[i] * symbolicBase
+		s.End.Const -= s.End.Coeffs[i] * symbolicBase
+		if step.Elem != nil {
+			elems = append(elems, *step.Elem)
+		}
+	}
+	if base.Elem != nil {
+		elem, ok := fit(*base.Elem, elems)
+		s.Elem = &elem
+		return s, ok
+	}
+	return s, true
+}
+
+// Returns the arguments a summary is checked at: a few more single values,
+// and some ranges.
+func checkpoints(shape []Type) [][]Type {
+	var points [][]Type
+	for _, r := range []Range{{symbolicBase + 2, symbolicBase + 2},
+		{symbolicBase + 7, symbolicBase + 7}, {symbolicBase, symbolicBase + 3},
+		{symbolicBase + 1, symbolicBase + 9}} {
+		args := make([]Type, len(shape))
+		for i := range args {
+			args[i] = shape[i]
+			args[i].Range = Range{r.Start + i, r.End + 2*i}
+		}
+		points = append(points, args)
+	}
+	return points
+}
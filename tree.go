@@ -2,6 +2,7 @@ package madison
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Represents a node in the tree (i.e. a thing that, if it has a type, can be
@@ -14,8 +15,8 @@ type Node interface {
 	Type(callers []CallSite, locals []Type) (Type, error)
 
 	// Attempts to update the given arguments so that the result is a subset
-	// of the given type.
-	RestrictTo(locals []Type, t Type) error
+	// of the given type, within the given calls.
+	RestrictTo(callers []CallSite, locals []Type, t Type) error
 
 	String() string
 }
@@ -49,6 +50,49 @@ func (p *Plus) String() string {
 	return fmt.Sprintf("(%s + %s)", p.A, p.B)
 }
 
+// binary multiplication (a * b)
+type Times struct{ A, B Node }
+
+var _ Node = &Times{}
+
+// Prints the product of the two arguments.
+func (t *Times) String() string {
+	return fmt.Sprintf("(%s * %s)", t.A, t.B)
+}
+
+// binary integer division (a / b)
+type Divide struct{ A, B Node }
+
+var _ Node = &Divide{}
+
+// Prints the quotient of the two arguments.
+func (d *Divide) String() string {
+	return fmt.Sprintf("(%s / %s)", d.A, d.B)
+}
+
+// binary remainder (a % b)
+type Modulo struct{ A, B Node }
+
+var _ Node = &Modulo{}
+
+// Prints the remainder of the two arguments.
+func (m *Modulo) String() string {
+	return fmt.Sprintf("(%s %% %s)", m.A, m.B)
+}
+
+// binary comparison (a < b, a == b, ...), yielding 1 if true and 0 if false
+type Compare struct {
+	Op   string
+	A, B Node
+}
+
+var _ Node = &Compare{}
+
+// Prints the comparison of the two arguments.
+func (c *Compare) String() string {
+	return fmt.Sprintf("(%s %s %s)", c.A, c.Op, c.B)
+}
+
 // Negates the given node.
 type Negate struct{ Elem Node }
 
@@ -120,6 +164,40 @@ func (h *Tail) String() string {
 	return fmt.Sprintf("tail(%s)", h.List)
 }
 
+// Computes the number of elements in List (for the length tests list
+// patterns compile to).
+type length struct {
+	List Node
+}
+
+var _ Node = &length{}
+
+// Pretty-prints this length.
+func (l *length) String() string {
+	return fmt.Sprintf("length(%s)", l.List)
+}
+
+// Binds Value to the local variable Index while computing Body.
+type Let struct {
+	Index       int
+	Value, Body Node
+}
+
+var _ Node = &Let{}
+
+// Pretty-prints this binding.
+func (l *Let) String() string {
+	return fmt.Sprintf("let %s = %s in %s", &Var{l.Index}, l.Value, l.Body)
+}
+
+// Returns how many locals Body sees, given n outside of it.
+func (l *Let) scope(n int) int {
+	if l.Index >= n {
+		return l.Index + 1
+	}
+	return n
+}
+
 // Represents unconditional failure (represents pattern match failure).
 type Undef struct {
 	Message string
@@ -132,21 +210,172 @@ func (u *Undef) String() string {
 	return "undef()"
 }
 
+// Remembers where in the source Node came from.
+type Located struct {
+	Span
+	Node
+
+	// The runtime Node was parsed into, whose options apply to it.
+	runtime *Runtime
+}
+
+var _ Node = &Located{}
+
+// Returns where the given node came from, if known.
+func SpanOf(n Node) (Span, bool) {
+	if l, ok := n.(*Located); ok {
+		return l.Span, true
+	}
+	return Span{}, false
+}
+
+// Removes any position information from the given node.
+func unlocated(n Node) Node {
+	if l, ok := n.(*Located); ok {
+		return l.Node
+	}
+	return n
+}
+
+// Pretty-prints the located node.
+func (l *Located) String() string {
+	return l.Node.String()
+}
+
 // Stores all named functions in the runtime.
 type Runtime struct {
 	Funcs map[string]Node
+
+	// How many of the most recent call sites to keep when analysing a call
+	// (the k in k-CFA). Zero keeps the entire call chain.
+	Sensitivity int
+
+	// Whether to track bounds on the sums and differences of pairs of
+	// arguments, as well as on each one (see ExampleCompare_relational).
+	Relational bool
+
+	// Whether to track the types of the first few elements of lists, as well
+	// as of all of them (see ExampleHead).
+	Prefixes bool
+
+	// Whether ParseFile should keep going past equations that fail to
+	// parse, defining the rest and then reporting every problem as
+	// ParseErrors.
+	KeepGoing bool
+
+	// The declared types of functions; calls to these are checked against
+	// their signature rather than analysing the body (see Check).
+	Signatures map[string]Signature
+
+	// The results of functions in terms of their arguments; calls to these
+	// instantiate the summary rather than analysing the body (see
+	// Summarize).
+	Symbolic map[string]Symbolic
+
+	// How many arguments each parsed function takes.
+	arity map[string]int
+
+	// The name of each argument of each parsed function, or "" where no
+	// equation gives it one.
+	params map[string][]string
+
+	// How deeply calls are nested in Eval, and how deep they may go (if
+	// limited; see limited).
+	depth, maxDepth int
+
+	// The results of previously analysed calls; cleared whenever a function
+	// is (re)defined.
+	summaries map[summaryKey]summary
 }
 
 // Call a function in the current runtime by name.
 type Apply struct {
 	Runtime *Runtime
 	Name    string
-	Arg     Node
+	Args    []Node
 }
 
 var _ Node = &Apply{}
 
 // Pretty-print this Apply call.
 func (a *Apply) String() string {
-	return fmt.Sprintf("%s(%s)", a.Name, a.Arg)
+	args := make([]string, len(a.Args))
+	for i, arg := range a.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", a.Name, strings.Join(args, ", "))
+}
+
+// Returns the nodes directly inside n.
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case *Plus:
+		return []Node{n.A, n.B}
+	case *Times:
+		return []Node{n.A, n.B}
+	case *Divide:
+		return []Node{n.A, n.B}
+	case *Modulo:
+		return []Node{n.A, n.B}
+	case *Compare:
+		return []Node{n.A, n.B}
+	case *Negate:
+		return []Node{n.Elem}
+	case *If:
+		return []Node{n.Cond, n.NonPositive, n.Positive}
+	case *Prepend:
+		return []Node{n.Head, n.Tail}
+	case *Head:
+		return []Node{n.List}
+	case *Tail:
+		return []Node{n.List}
+	case *length:
+		return []Node{n.List}
+	case *Let:
+		return []Node{n.Value, n.Body}
+	case *Located:
+		return []Node{n.Node}
+	case *Apply:
+		return n.Args
+	}
+	return nil
+}
+
+// Returns a copy of n whose calls go to r.
+func rebind(n Node, r *Runtime) Node {
+	switch n := n.(type) {
+	case *Plus:
+		return &Plus{rebind(n.A, r), rebind(n.B, r)}
+	case *Times:
+		return &Times{rebind(n.A, r), rebind(n.B, r)}
+	case *Divide:
+		return &Divide{rebind(n.A, r), rebind(n.B, r)}
+	case *Modulo:
+		return &Modulo{rebind(n.A, r), rebind(n.B, r)}
+	case *Compare:
+		return &Compare{n.Op, rebind(n.A, r), rebind(n.B, r)}
+	case *Negate:
+		return &Negate{rebind(n.Elem, r)}
+	case *If:
+		return &If{rebind(n.Cond, r), rebind(n.NonPositive, r), rebind(n.Positive, r)}
+	case *Prepend:
+		return &Prepend{rebind(n.Head, r), rebind(n.Tail, r)}
+	case *Head:
+		return &Head{rebind(n.List, r)}
+	case *Tail:
+		return &Tail{rebind(n.List, r)}
+	case *length:
+		return &length{rebind(n.List, r)}
+	case *Let:
+		return &Let{n.Index, rebind(n.Value, r), rebind(n.Body, r)}
+	case *Located:
+		return &Located{n.Span, rebind(n.Node, r), r}
+	case *Apply:
+		args := make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = rebind(arg, r)
+		}
+		return &Apply{r, n.Name, args}
+	}
+	return n
 }
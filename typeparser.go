@@ -0,0 +1,227 @@
+package madison
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Reads a Type out of text, in the form printed by Type.String.
+type typeParser struct {
+	text string
+	pos  int
+}
+
+// Parses the whole of text as a Type, in the form printed by Type.String
+// (e.g. int[1, 8] or [3, 5]int[1, 5]). A bare range such as [0, 10] is taken
+// to be a range of integers, and -inf and inf may be written for -∞ and ∞.
+func ParseType(text string) (Type, error) {
+	p := &typeParser{text: text}
+	t, err := p.parse()
+	if err != nil {
+		return NIL, err
+	}
+	if p.skip(); p.pos < len(p.text) {
+		return NIL, p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	return t, nil
+}
+
+// Reports a problem at the current position.
+func (p *typeParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid type %q: %s", p.text, fmt.Sprintf(format, args...))
+}
+
+// Skips any whitespace.
+func (p *typeParser) skip() {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+// Consumes prefix if the text continues with it.
+func (p *typeParser) accept(prefix string) bool {
+	p.skip()
+	if strings.HasPrefix(p.text[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// Parses a scalar or list type.
+func (p *typeParser) parse() (Type, error) {
+	switch {
+	case p.accept("any"):
+		return p.stride(Type{Range: UNDEF})
+	case p.accept("int"):
+		s, err := p.set()
+		if err != nil {
+			return NIL, err
+		}
+		return p.stride(typeOf(s))
+	case p.accept("[") || p.accept("("):
+		p.pos--
+		s, err := p.set()
+		if err != nil {
+			return NIL, err
+		}
+		if p.skip(); p.pos == len(p.text) || p.ends() {
+			return p.stride(typeOf(s))
+		}
+		prefix, err := p.prefix()
+		if err != nil {
+			return NIL, err
+		}
+		elem, err := p.parse()
+		if err != nil {
+			return NIL, err
+		}
+		for _, t := range prefix {
+			if !t.SubsetOf(elem) {
+				return NIL, p.errorf("leading element %s is outside the elements %s", t, elem)
+			}
+		}
+		return trimPrefix(Type{Elem: &elem, Prefix: prefix}.withRanges(s)), nil
+	}
+	n, err := p.number()
+	if err != nil {
+		return NIL, err
+	}
+	return p.stride(Constant(n))
+}
+
+// Parses the types of the leading elements of a list ({5, 4, int[0, 3]}),
+// if there are any.
+func (p *typeParser) prefix() ([]Type, error) {
+	if !p.accept("{") {
+		return nil, nil
+	}
+	var prefix []Type
+	for {
+		t, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		prefix = append(prefix, t)
+		if p.accept("}") {
+			return prefix, nil
+		} else if !p.accept(",") {
+			return nil, p.errorf("expected , or } after %s", t)
+		}
+	}
+}
+
+// Parses the congruence (≡ r (mod m)) that may follow the scalar t.
+func (p *typeParser) stride(t Type) (Type, error) {
+	if !p.accept("≡") {
+		return t, nil
+	}
+	r, err := p.number()
+	if err != nil {
+		return NIL, err
+	}
+	if !p.accept("(") || !p.accept("mod") {
+		return NIL, p.errorf("expected (mod after ≡ %d", r)
+	}
+	m, err := p.number()
+	if err != nil {
+		return NIL, err
+	} else if !p.accept(")") {
+		return NIL, p.errorf("expected ) after mod %d", m)
+	}
+	t, ok := t.withStride(makeCongruence(m, r))
+	if !ok {
+		return NIL, p.errorf("no values are %d modulo %d", r, m)
+	}
+	return t, nil
+}
+
+// Returns true if the text continues with something that can't start a type.
+func (p *typeParser) ends() bool {
+	rest := p.text[p.pos:]
+	return strings.HasPrefix(rest, "->") || strings.HasPrefix(rest, "≡") ||
+		strings.ContainsRune(",)]}", rune(rest[0]))
+}
+
+// Parses one or more bracketed ranges, separated by ∪ (or U).
+func (p *typeParser) set() (RangeSet, error) {
+	var rs []Range
+	for {
+		r, err := p.bounds()
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+		if !p.accept("∪") && !p.accept("U") {
+			return Ranges(rs...), nil
+		}
+	}
+}
+
+// Parses a bracketed range: [a, b], (-∞, b], [a, ∞), [n] or [any].
+func (p *typeParser) bounds() (Range, error) {
+	r := UNDEF
+	if p.accept("(") {
+		if !p.accept("-∞") && !p.accept("-inf") {
+			return r, p.errorf("expected -∞ after (")
+		}
+	} else if !p.accept("[") {
+		return r, p.errorf("expected [ or (")
+	} else if p.accept("any") {
+		if !p.accept("]") {
+			return r, p.errorf("expected ] after any")
+		}
+		return r, nil
+	} else {
+		n, err := p.number()
+		if err != nil {
+			return r, err
+		}
+		r.Start = n
+		if p.accept("]") {
+			return Range{n, n}, nil
+		}
+	}
+
+	if !p.accept(",") {
+		return r, p.errorf("expected , in range")
+	}
+	if p.accept("∞") || p.accept("inf") {
+		if !p.accept(")") {
+			return r, p.errorf("expected ) after ∞")
+		}
+	} else {
+		n, err := p.number()
+		if err != nil {
+			return r, err
+		}
+		r.End = n
+		if !p.accept("]") {
+			return r, p.errorf("expected ] after %d", n)
+		}
+	}
+	if r.Start > r.End {
+		return r, p.errorf("empty range")
+	}
+	return r, nil
+}
+
+// Parses a (possibly negative) integer strictly between the infinities.
+func (p *typeParser) number() (int, error) {
+	p.skip()
+	start := p.pos
+	if p.pos < len(p.text) && p.text[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.text) && unicode.IsDigit(rune(p.text[p.pos])) {
+		p.pos++
+	}
+	n, err := strconv.ParseInt(p.text[start:p.pos], 10, 64)
+	if err != nil || n <= math.MinInt32 || n >= math.MaxInt32 {
+		return 0, p.errorf("invalid integer %q", p.text[start:p.pos])
+	}
+	return int(n), nil
+}
@@ -0,0 +1,84 @@
+package madison
+
+import (
+	"testing"
+)
+
+var anything = Type{Range: UNDEF}
+
+var printed = []Type{
+	NIL,
+	anything,
+	Constant(5),
+	Constant(-3),
+	InRange(1, 8),
+	InRange(ninf, 3),
+	InRange(-2, inf),
+	{Range: Range{3, 5}, Elem: &Type{Range: Range{1, 5}}},
+	{Range: Range{0, 0}, Elem: &anything},
+	{Range: Range{0, 0}, Elem: &NIL},
+	{Range: Range{2, 2}, Elem: &Type{Range: Range{-3, -3}}},
+	{Range: Range{0, inf}, Elem: &Type{Range: Range{1, 3},
+		Elem: &Type{Range: Range{ninf, 0}}}},
+	{Range: UNDEF, Elem: &anything},
+	typeOf(Ranges(Range{ninf, -1}, Range{2, inf})),
+	typeOf(Ranges(Range{0, 0}, Range{2, 2}, Range{4, 9})),
+	Type{Elem: &anything}.withRanges(Ranges(Range{0, 0}, Range{3, inf})),
+	{Range: Range{0, 100}, Stride: Congruence{2, 0}},
+	{Range: Range{0, 1}, Elem: &Type{Range: Range{-3, inf}, Stride: Congruence{4, 1}}},
+	{Range: Range{2, 5}, Elem: &Type{Range: Range{1, 5}},
+		Prefix: []Type{Constant(5), InRange(2, 4)}},
+	{Range: Range{1, inf}, Elem: &Type{Range: Range{0, 3}, Elem: &anything},
+		Prefix: []Type{{Range: Range{1, 3}, Elem: &anything}}},
+}
+
+func TestParseTypeRoundTrip(t *testing.T) {
+	for i, typ := range printed {
+		got, err := ParseType(typ.String())
+		if err != nil {
+			t.Errorf("%d: ParseType(%q) failed: %s", i, typ, err)
+		} else if got.String() != typ.String() {
+			t.Errorf("%d: ParseType(%q) = %s", i, typ, got)
+		}
+	}
+}
+
+var spelled = []struct {
+	Text, Exp string
+}{
+	{"[0, 10]", "int[0, 10]"},
+	{" int [ 1 , 2 ] ", "int[1, 2]"},
+	{"(-inf, 4]", "int(-∞, 4]"},
+	{"[1, inf)[0]any", "[1, ∞)[0]any"},
+	{"[3]", "3"},
+	{"int[0] U [2, 3] U [4]", "int[0] ∪ [2, 4]"},
+	{"[1] ∪ [3, 4]any", "[1] ∪ [3, 4]any"},
+	{"[0, 10] ≡ 1 (mod 4)", "int[1, 9] ≡ 1 (mod 4)"},
+	{"int[0, 1] ∪ [4, 10] ≡ -1 (mod 3)", "int[5, 8] ≡ 2 (mod 3)"},
+	{"[2, 3] ≡ 0 (mod 2)", "2"},
+	{"[1, 2]{5, int[0, 1], 7}int[0, 9]", "[1, 2]{5, int[0, 1]}int[0, 9]"},
+	{"[3]{int[0, 9]}int[0, 9]", "[3]int[0, 9]"},
+}
+
+func TestParseTypeSpellings(t *testing.T) {
+	for i, c := range spelled {
+		got, err := ParseType(c.Text)
+		if err != nil {
+			t.Errorf("%d: ParseType(%q) failed: %s", i, c.Text, err)
+		} else if got.String() != c.Exp {
+			t.Errorf("%d: ParseType(%q) = %s (expecting %s)", i, c.Text, got, c.Exp)
+		}
+	}
+}
+
+func TestParseTypeErrors(t *testing.T) {
+	for _, text := range []string{
+		"", "int", "[1, 2", "[2, 1]", "(1, 2]", "[1, ∞]", "int[0, 1] 5",
+		"99999999999", "[1, 2]int[", "[1, 3] ≡ 0 (mod 4)", "5 ≡ 1",
+		"[2]{1 2}int", "[2]{}int", "[2]{1, 2", "[1]{20}int[0, 9]",
+	} {
+		if got, err := ParseType(text); err == nil {
+			t.Errorf("ParseType(%q) = %s (expecting an error)", text, got)
+		}
+	}
+}
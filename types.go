@@ -3,10 +3,102 @@ package madison
 import (
 	"fmt"
 	"math"
+	"strings"
 )
 
-// Represent a callsite (not implemented yet).
-type CallSite struct{}
+// Represents a single function call on the inference stack.
+type CallSite struct {
+	// The name of the function being called.
+	Name string
+
+	// The types of the arguments the function was called with.
+	Args []Type
+
+	// Which node made the call.
+	Context Node
+
+	// The fixpoint state of the call, if it is still being analysed.
+	frame *frame
+
+	// Whether RestrictTo made the call, to narrow its arguments; calls it
+	// makes to the same function are left alone.
+	restricting bool
+
+	// Whether calls the function makes to itself take its summary, rather
+	// than being analysed (see Summarize).
+	summarized bool
+
+	// The runtime the function belongs to, whose options apply to its body.
+	runtime *Runtime
+}
+
+// Returns the runtime of the innermost call in cs, whose options apply to the
+// body being analysed, or nil if it has none.
+func runtimeOf(cs []CallSite) *Runtime {
+	if len(cs) > 0 {
+		return cs[len(cs)-1].runtime
+	}
+	return nil
+}
+
+// Returns cs with the options of r applying to its innermost call (or to a
+// call with no name, if cs is empty).
+func within(cs []CallSite, r *Runtime) []CallSite {
+	site := CallSite{runtime: r}
+	if len(cs) > 0 {
+		site = cs[len(cs)-1]
+		site.runtime = r
+		cs = cs[: len(cs)-1 : len(cs)-1]
+	}
+	return append(cs, site)
+}
+
+// Whether r (which may be nil) tracks relations between locals.
+func (r *Runtime) relational() bool {
+	return r != nil && r.Relational
+}
+
+// Whether r (which may be nil) tracks the leading elements of lists.
+func (r *Runtime) prefixes() bool {
+	return r != nil && r.Prefixes
+}
+
+// Pretty-prints this call site.
+func (c CallSite) String() string {
+	return fmt.Sprintf("%s(%s)", c.Name, typesString(c.Args))
+}
+
+// Pretty-prints a list of types, separated by commas.
+func typesString(ts []Type) string {
+	strs := make([]string, len(ts))
+	for i, t := range ts {
+		strs[i] = t.String()
+	}
+	return strings.Join(strs, ", ")
+}
+
+// Represents a failure that happened inside a (possibly nested) function call.
+type CallError struct {
+	// The call chain leading to the failure, outermost first.
+	Callers []CallSite
+
+	// The underlying failure.
+	Err error
+}
+
+// Represent the failure, along with the call chain, as an error.
+func (c *CallError) Error() string {
+	var chain []string
+	for i := len(c.Callers) - 1; i >= 0; i-- {
+		if c.Callers[i].Name != "" { // not just where options were set
+			chain = append(chain, c.Callers[i].String())
+		}
+	}
+	if len(chain) == 0 {
+		return c.Err.Error()
+	}
+	return fmt.Sprintf("%s, in %s", c.Err, strings.Join(chain, " <- "))
+}
 
 // Represents a type.
 type Type struct {
@@ -16,6 +108,153 @@ type Type struct {
 	// If non-nil: this Type is a list containing Elem elemnts.
 	// else: this type is a scalar.
 	Elem *Type
+
+	// If a list: the types of its first few elements (where it has them),
+	// each within Elem but perhaps narrower.
+	Prefix []Type
+
+	// If non-nil: the values (or lengths) within Range this type can have,
+	// when that is not all of them.
+	Set RangeSet
+
+	// If Stride.Mod > 1: every value is equal to Stride.Rem, modulo
+	// Stride.Mod.
+	Stride Congruence
+
+	// If a local: how it relates to the other locals.
+	rel relations
+}
+
+// Returns the values (or lengths) this type can have.
+func (t Type) ranges() RangeSet {
+	if t.Set != nil {
+		return t.Set
+	}
+	return RangeSet{t.Range}
+}
+
+// Returns a copy of t holding only the values (or lengths) in s, which must
+// not be empty.
+func (t Type) withRanges(s RangeSet) Type {
+	t.Range, t.Set = s.hull(), nil
+	if len(s) > 1 {
+		t.Set = s
+	}
+	return t
+}
+
+// Returns the scalar type holding the values in s, which must not be empty.
+func typeOf(s RangeSet) Type {
+	return Type{}.withRanges(s)
+}
+
+// A position in the source text.
+type Pos struct {
+	Line, Col int
+}
+
+// A stretch of source text (e.g. that a Node was parsed from).
+type Span struct {
+	// The file the text came from, if known.
+	File string
+
+	// Where the text starts, and the position just after it ends.
+	Start, End Pos
+}
+
+// Prints where this span starts, as file:line:col.
+func (s Span) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("%d:%d", s.Start.Line, s.Start.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", s.File, s.Start.Line, s.Start.Col)
+}
+
+// Represents an error raised by the Node at a particular place in the source.
+type PosError struct {
+	Span
+
+	// The underlying failure.
+	Err error
+}
+
+// Represent the failure, along with where it happened, as an error.
+func (p *PosError) Error() string {
+	return fmt.Sprintf("%s: %s", p.Span, p.Err)
+}
+
+// The kinds of problem that can be found while parsing.
+type ParseErrorKind int
+
+const (
+	// The text isn't a well-formed equation.
+	SyntaxError ParseErrorKind = iota
+
+	// A function was given the wrong number of arguments.
+	ArityError
+
+	// An integer literal can't be represented.
+	LiteralError
+
+	// The left-hand side has something that can't be matched against.
+	PatternError
+
+	// A name isn't bound to any variable or function.
+	NameError
+)
+
+// Names this kind of problem.
+func (k ParseErrorKind) String() string {
+	switch k {
+	case SyntaxError:
+		return "syntax error"
+	case ArityError:
+		return "arity error"
+	case LiteralError:
+		return "literal error"
+	case PatternError:
+		return "pattern error"
+	case NameError:
+		return "name error"
+	}
+	return fmt.Sprintf("ParseErrorKind(%d)", int(k))
+}
+
+// Represents a problem found while parsing.
+type ParseError struct {
+	Kind ParseErrorKind
+
+	// What went wrong.
+	Message string
+
+	// Where it went wrong.
+	Span
+}
+
+// Represent the parse error as an error.
+func (p *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", p.Span, p.Kind, p.Message)
+}
+
+// Represents every problem found while parsing a file, from top to bottom.
+type ParseErrors []*ParseError
+
+// Represent the parse errors as an error, one per line.
+func (p ParseErrors) Error() string {
+	msgs := make([]string, len(p))
+	for i, err := range p {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Returns each of the parse errors.
+func (p ParseErrors) Unwrap() []error {
+	errs := make([]error, len(p))
+	for i, err := range p {
+		errs[i] = err
+	}
+	return errs
 }
 
 // Represents a type mismatch.
@@ -32,8 +271,21 @@ type Impossible struct {
 
 // Represent the Type error as an error.
 func (i *Impossible) Error() string {
-	return fmt.Sprintf("needed %s, but got %s, in %s",
-		i.Found, i.Needed, i.Context)
+	return fmt.Sprintf("needed %s, but %s is %s", i.Found, i.Context, i.Needed)
+}
+
+// Represents a division by a value that might be zero.
+type DivideByZero struct {
+	// Which node divides.
+	Context Node
+
+	// What the divisor evaluated to.
+	Divisor Type
+}
+
+// Represent the division error as an error.
+func (d *DivideByZero) Error() string {
+	return fmt.Sprintf("divisor may be zero: %s, in %s", d.Divisor, d.Context)
 }
 
 var (
@@ -64,13 +316,25 @@ func InRange(min, max int) Type {
 //   [2, 5][1, 2]int[3, 4]
 //   ^ dimensions   ^ range of values
 //
+// The types of a list's first few elements, if narrower, follow its
+// length: [2, 5]{4, int[3, 4]}int[1, 4].
+//
 func (t Type) String() string {
+	if t.Set != nil && t.Elem != nil {
+		return t.Set.String() + t.prefixString() + t.Elem.String()
+	} else if t.Stride.Mod > 1 {
+		s := t
+		s.Stride = Congruence{}
+		return fmt.Sprintf("%s %s", s, t.Stride)
+	} else if t.Set != nil {
+		return "int" + t.Set.String()
+	}
 	if t.Elem != nil {
 		r := t.Range.String()
 		if r[0] != '[' && r[0] != '(' {
 			r = "[" + r + "]"
 		}
-		return r + t.Elem.String()
+		return r + t.prefixString() + t.Elem.String()
 	}
 	s := t.Range.String()
 	if s[0] == '[' || s[0] == '(' {
@@ -79,18 +343,41 @@ func (t Type) String() string {
 	return s
 }
 
+// Pretty-prints the types of the leading elements of a list, if it has any:
+// {5, 4, int[0, 3]}.
+func (t Type) prefixString() string {
+	if len(t.Prefix) == 0 {
+		return ""
+	}
+	return "{" + typesString(t.Prefix) + "}"
+}
+
 // Returns true if the given type is a subset of another.
 func (t Type) SubsetOf(o Type) bool {
-	if !(t.Start <= o.End && o.Start <= t.End) {
+	if t.Start < o.Start || o.End < t.End || (t.Elem == nil) != (o.Elem == nil) {
+		return false
+	} else if o.Set != nil && len(t.ranges().subtract(o.Set)) > 0 {
 		return false
+	} else if t.Elem == nil && !t.congruence().within(o.congruence()) {
+		return false
+	}
+	if t.Elem == nil || t.End <= 0 {
+		return true
+	}
+	for i := range o.Prefix {
+		if i < t.End && !t.at(i).SubsetOf(o.Prefix[i]) {
+			return false
+		}
 	}
-	return (t.Start < o.Start || o.End < t.End ||
-		(t.Elem != nil && o.Elem != nil && t.Elem.SubsetOf(*o.Elem)))
+	return t.Elem.SubsetOf(*o.Elem)
 }
 
 // Joins the two types together (making one that is less specific than either).
 func TypesUnion(a, b Type) (Type, error) {
-	t := Type{Range: union(a.Range, b.Range)}
+	t := typeOf(a.ranges().union(b.ranges()))
+	if c := congruenceUnion(a.congruence(), b.congruence()); a.Elem == nil && c.Mod > 1 {
+		t.Stride = c
+	}
 	if a.Elem != nil {
 		if a.Range.End == 0 {
 			t.Elem = b.Elem
@@ -100,6 +387,34 @@ func TypesUnion(a, b Type) (Type, error) {
 			u, _ := TypesUnion(*a.Elem, *b.Elem)
 			t.Elem = &u
 		}
+		t = prefixes(t, a, b, func(a, b Type) Type {
+			u, _ := TypesUnion(a, b)
+			return u
+		})
 	}
 	return t, nil // add loads more checking
 }
+
+// Joins the two types together, jumping to infinity along any bound that
+// grew. Repeatedly widening a type is guaranteed to stop changing it.
+func TypesWiden(a, b Type) Type {
+	t := Type{Range: widen(a.Range, b.Range)}
+	if c := congruenceUnion(a.congruence(), b.congruence()); a.Elem == nil && c.Mod > 1 {
+		t.Stride = c
+	}
+	if a.Elem != nil && b.Elem != nil {
+		if t.Start < 0 {
+			t.Start = 0
+		}
+		if a.Range.End == 0 {
+			t.Elem = b.Elem
+		} else if b.Range.End == 0 {
+			t.Elem = a.Elem
+		} else {
+			w := TypesWiden(*a.Elem, *b.Elem)
+			t.Elem = &w
+		}
+		t = prefixes(t, a, b, TypesWiden)
+	}
+	return t
+}